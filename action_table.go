@@ -0,0 +1,180 @@
+package warcrumb
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// actionSpec describes an action id as it appears inside a CommandData block
+type actionSpec struct {
+	name string
+	// whether issuing this action counts as an "action" for APM purposes
+	countsForAPM bool
+	// payloadLen returns how many bytes follow the action id, given the rest of the action block.
+	// ok is false if the length can't be determined (e.g. an unterminated string)
+	payloadLen func(rest []byte, version int) (n int, ok bool)
+}
+
+// actionTable has every action id we know the layout of, numbered as in the current (1.14b+) format.
+// See normalizeActionId for older replays.
+// Lengths are from w3g_format.txt plus what newer versions of the game (incl. Reforged) send.
+var actionTable = map[byte]actionSpec{
+	0x01: {"Pause game", false, fixedLen(0)},
+	0x02: {"Resume game", false, fixedLen(0)},
+	0x03: {"Set game speed", false, fixedLen(1)},
+	0x04: {"Increase game speed", false, fixedLen(0)},
+	0x05: {"Decrease game speed", false, fixedLen(0)},
+	0x06: {"Save game", false, stringsLen(0, 1, 0)},
+	0x07: {"Save game finished", false, fixedLen(4)},
+	0x10: {"Ability", true, abilityLen(0)},
+	0x11: {"Ability with target position", true, abilityLen(8)},
+	0x12: {"Ability with target position and object", true, abilityLen(8 + 8)},
+	0x13: {"Give or drop item", true, abilityLen(8 + 8 + 8)},
+	0x14: {"Ability with two target positions and items", true, abilityLen(8 + 4 + 9 + 8)},
+	0x16: {"Change selection", true, objectListLen},
+	0x17: {"Assign group hotkey", true, objectListLen},
+	0x18: {"Select group hotkey", true, fixedLen(2)},
+	0x19: {"Select subgroup", false, subgroupLen},
+	0x1A: {"Pre subselection", false, fixedLen(0)},
+	0x1B: {"Unknown 0x1B", false, fixedLen(9)},
+	0x1C: {"Select ground item", true, fixedLen(9)},
+	0x1D: {"Cancel hero revival", true, fixedLen(8)},
+	0x1E: {"Remove unit from building queue", true, fixedLen(5)},
+	0x20: {"Cheat: TheDudeAbides", false, fixedLen(0)},
+	0x21: {"Unknown 0x21", false, fixedLen(8)},
+	0x22: {"Cheat: SomebodySetUpUsTheBomb", false, fixedLen(0)},
+	0x23: {"Cheat: WarpTen", false, fixedLen(0)},
+	0x24: {"Cheat: IocainePowder", false, fixedLen(0)},
+	0x25: {"Cheat: PointBreak", false, fixedLen(0)},
+	0x26: {"Cheat: WhosYourDaddy", false, fixedLen(0)},
+	0x27: {"Cheat: KeyserSoze", false, fixedLen(5)},
+	0x28: {"Cheat: LeafitToMe", false, fixedLen(5)},
+	0x29: {"Cheat: ThereIsNoSpoon", false, fixedLen(0)},
+	0x2A: {"Cheat: StrengthAndHonor", false, fixedLen(0)},
+	0x2B: {"Cheat: itvexesme", false, fixedLen(0)},
+	0x2C: {"Cheat: WhoIsJohnGalt", false, fixedLen(0)},
+	0x2D: {"Cheat: GreedIsGood", false, fixedLen(5)},
+	0x2E: {"Cheat: DayLightSavings", false, fixedLen(4)},
+	0x2F: {"Cheat: ISeeDeadPeople", false, fixedLen(0)},
+	0x30: {"Cheat: Synergy", false, fixedLen(0)},
+	0x31: {"Cheat: SharpAndShiny", false, fixedLen(0)},
+	0x32: {"Cheat: AllYourBaseAreBelongToUs", false, fixedLen(0)},
+	0x50: {"Change ally options", false, fixedLen(5)},
+	0x51: {"Transfer resources", false, fixedLen(9)},
+	0x60: {"Map trigger chat command", false, stringsLen(8, 1, 0)},
+	0x61: {"ESC pressed", true, fixedLen(0)},
+	0x62: {"Scenario trigger", false, fixedLen(12)},
+	0x64: {"Trackable hit", false, fixedLen(8)},
+	0x65: {"Trackable track", false, fixedLen(8)},
+	0x66: {"Enter choose hero skill submenu", true, fixedLen(0)},
+	0x67: {"Enter choose building submenu", true, fixedLen(0)},
+	0x68: {"Minimap signal", false, fixedLen(12)},
+	0x69: {"Continue game (block B)", false, fixedLen(16)},
+	0x6A: {"Continue game (block A)", false, fixedLen(16)},
+	0x6B: {"Sync stored integer", false, stringsLen(0, 3, 4)},
+	0x6C: {"Sync stored real", false, stringsLen(0, 3, 4)},
+	0x6D: {"Sync stored boolean", false, stringsLen(0, 3, 4)},
+	// the stored unit (items, hero stats and abilities) after the 3 strings isn't documented
+	0x6E: {"Sync stored unit", false, restOfBlockLen},
+	0x70: {"Sync stored string", false, stringsLen(0, 3, 0)},
+	0x75: {"Arrow key", false, fixedLen(1)},
+	// Reforged
+	0x76: {"Mouse event", false, fixedLen(10)},
+	0x77: {"W3API command", false, w3apiLen},
+	0x78: {"Blz sync", false, stringsLen(0, 2, 4)},
+	0x79: {"Command frame event", false, stringsLen(16, 1, 0)},
+	0x7A: {"Unknown 0x7A", false, fixedLen(20)},
+	0x7B: {"Unknown 0x7B", false, fixedLen(16)},
+	0xA0: {"Unknown 0xA0", false, fixedLen(14)},
+	0xA1: {"Unknown 0xA1", false, fixedLen(9)},
+}
+
+// normalizeActionId maps action ids from older patches onto the current numbering used by actionTable.
+func normalizeActionId(id byte, version int) byte {
+	// 1.14b inserted 0x1A and 0x1B, shifting the next three actions up by 2
+	if version < 14 && id >= 0x1A && id <= 0x1C {
+		return id + 2
+	}
+	if version < 7 {
+		// 1.07 inserted an action before the submenu ones
+		if id >= 0x65 && id <= 0x69 {
+			return id + 1
+		}
+		// remove from queue was still 0x1D (it's 5 bytes, e.g. "00 64 6f 6b 6f" in the 1.01 test replay),
+		// so it doesn't get read as the 8 byte cancel hero revival
+		if id == 0x1D {
+			return 0x1E
+		}
+	}
+	return id
+}
+
+func fixedLen(n int) func([]byte, int) (int, bool) {
+	return func([]byte, int) (int, bool) {
+		return n, true
+	}
+}
+
+// abilityLen is for the 0x10-0x14 family, which share a header that grew over time
+func abilityLen(extra int) func([]byte, int) (int, bool) {
+	return func(_ []byte, version int) (int, bool) {
+		return abilityHeaderLen(version) + extra, true
+	}
+}
+
+func abilityHeaderLen(version int) int {
+	n := 2 + 4 // flags + item id
+	if version < 13 {
+		n = 1 + 4
+	}
+	if version >= 7 {
+		n += 4 + 4
+	}
+	return n
+}
+
+// objectListLen is for actions with a mode/group byte followed by a WORD count of object id pairs
+func objectListLen(rest []byte, _ int) (int, bool) {
+	if len(rest) < 3 {
+		return 0, false
+	}
+	count := binary.LittleEndian.Uint16(rest[1:3])
+	return 3 + int(count)*8, true
+}
+
+func subgroupLen(_ []byte, version int) (int, bool) {
+	if version < 14 {
+		return 1, true // just the subgroup number
+	}
+	return 4 + 4 + 4, true
+}
+
+// stringsLen is for actions that have a fixed prefix, then some null terminated strings, then a fixed suffix
+func stringsLen(prefix, nStrings, suffix int) func([]byte, int) (int, bool) {
+	return func(rest []byte, _ int) (int, bool) {
+		n := prefix
+		for i := 0; i < nStrings; i++ {
+			if n > len(rest) {
+				return 0, false
+			}
+			end := bytes.IndexByte(rest[n:], 0)
+			if end < 0 {
+				return 0, false
+			}
+			n += end + 1
+		}
+		return n + suffix, true
+	}
+}
+
+// restOfBlockLen is for actions we can't work out the length of, which take up the rest of the action block
+func restOfBlockLen(rest []byte, _ int) (int, bool) {
+	return len(rest), true
+}
+
+func w3apiLen(rest []byte, _ int) (int, bool) {
+	if len(rest) < 12 {
+		return 0, false
+	}
+	return 12 + int(binary.LittleEndian.Uint32(rest[8:12])), true
+}
@@ -3,7 +3,9 @@ package warcrumb
 import (
 	"bytes"
 	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -45,17 +47,11 @@ func (a ItemId) String() string {
 	if full, ok := byteStrings[string(a[:])]; ok {
 		return full.Tip
 	}
-	if bytes.Contains(a[:], []byte{0x00}) {
+	if str, ok := a.Code(); !ok {
 		// alphanumeric id
 		//return string(a[:])
 		return fmt.Sprintf("%#02v", a)
 	} else {
-		// string
-		var reversed [4]byte
-		for i := 0; i < 4; i++ {
-			reversed[i] = a[3-i]
-		}
-		str := string(reversed[:])
 		if full, ok := WC3Strings[str]; ok {
 			return full.Tip
 		}
@@ -63,6 +59,18 @@ func (a ItemId) String() string {
 	}
 }
 
+// Code returns the 4-char code of the unit/ability/etc. (e.g. "hpea"), or false if this is a numeric order id.
+func (a ItemId) Code() (string, bool) {
+	if bytes.Contains(a[:], []byte{0x00}) {
+		return "", false
+	}
+	var reversed [4]byte
+	for i := 0; i < 4; i++ {
+		reversed[i] = a[3-i]
+	}
+	return string(reversed[:]), true
+}
+
 type ObjectId uint32
 
 func (o ObjectId) IsGround() bool {
@@ -76,6 +84,15 @@ func (o ObjectId) String() string {
 	}
 }
 
+// ObjectHandle refers to a single unit, building or item. The game always sends object ids in pairs.
+type ObjectHandle struct {
+	ObjectId1, ObjectId2 ObjectId
+}
+
+func (o ObjectHandle) String() string {
+	return fmt.Sprintf("(%s, %s)", o.ObjectId1, o.ObjectId2)
+}
+
 type BasicAbility struct {
 	AbilityFlags uint16
 	ItemId       ItemId
@@ -133,12 +150,353 @@ func (t TwoTargetTwoItemAbility) String() string {
 	return fmt.Sprintf("%s + %s to %s & %s", t.BasicAbility, t.ItemId2, t.Target, t.Target2)
 }
 
+type PauseGame struct{}
+
+func (PauseGame) String() string  { return "Pause game" }
+func (PauseGame) APMChange() int { return 0 }
+
+type ResumeGame struct{}
+
+func (ResumeGame) String() string  { return "Resume game" }
+func (ResumeGame) APMChange() int { return 0 }
+
+// SetGameSpeed is only available in single player.
+type SetGameSpeed struct {
+	Speed GameSpeed
+}
+
+func (s SetGameSpeed) String() string { return fmt.Sprintf("Set game speed to %s", s.Speed) }
+func (SetGameSpeed) APMChange() int   { return 0 }
+
+type IncreaseGameSpeed struct{}
+
+func (IncreaseGameSpeed) String() string  { return "Increase game speed" }
+func (IncreaseGameSpeed) APMChange() int { return 0 }
+
+type DecreaseGameSpeed struct{}
+
+func (DecreaseGameSpeed) String() string  { return "Decrease game speed" }
+func (DecreaseGameSpeed) APMChange() int { return 0 }
+
+// SaveGame is sent when a player starts saving the game.
+type SaveGame struct {
+	Filename string
+}
+
+func (s SaveGame) String() string { return fmt.Sprintf("Save game %q", s.Filename) }
+func (SaveGame) APMChange() int   { return 0 }
+
+// SaveGameFinished is sent once the save started by SaveGame has been written.
+type SaveGameFinished struct{}
+
+func (SaveGameFinished) String() string  { return "Save game finished" }
+func (SaveGameFinished) APMChange() int { return 0 }
+
+// AllyOptions is the bitfield sent when changing alliance settings towards another player.
+type AllyOptions uint32
+
+func (o AllyOptions) Allied() bool            { return o&0x1F == 0x1F }
+func (o AllyOptions) SharedVision() bool      { return o&0x20 != 0 }
+func (o AllyOptions) SharedUnitControl() bool { return o&0x40 != 0 }
+func (o AllyOptions) AlliedVictory() bool     { return o&0x400 != 0 }
+
+func (o AllyOptions) String() string {
+	var opts []string
+	if o.Allied() {
+		opts = append(opts, "allied")
+	} else {
+		opts = append(opts, "enemy")
+	}
+	if o.SharedVision() {
+		opts = append(opts, "shared vision")
+	}
+	if o.SharedUnitControl() {
+		opts = append(opts, "shared unit control")
+	}
+	if o.AlliedVictory() {
+		opts = append(opts, "allied victory")
+	}
+	return strings.Join(opts, ", ")
+}
+
+// ChangeAllyOptions is sent when a player changes their alliance settings towards the player in slot TargetSlot.
+type ChangeAllyOptions struct {
+	TargetSlot int
+	Options    AllyOptions
+}
+
+func (c ChangeAllyOptions) String() string {
+	return fmt.Sprintf("Change ally options towards slot %d: %s", c.TargetSlot, c.Options)
+}
+func (ChangeAllyOptions) APMChange() int { return 0 }
+
+// TransferResources is sent when a player gives gold and/or lumber to the player in slot TargetSlot.
+type TransferResources struct {
+	TargetSlot int
+	Gold       int
+	Lumber     int
+}
+
+func (t TransferResources) String() string {
+	return fmt.Sprintf("Send %d gold and %d lumber to slot %d", t.Gold, t.Lumber, t.TargetSlot)
+}
+func (TransferResources) APMChange() int { return 0 }
+
+// MinimapPing is a signal on the minimap (alt+click), shown to allies.
+type MinimapPing struct {
+	Target PointF
+	// Unknown is usually 5.0, possibly how long the ping lasts
+	Unknown float32
+}
+
+func (m MinimapPing) String() string { return fmt.Sprintf("Ping minimap at %s", m.Target) }
+func (MinimapPing) APMChange() int   { return 0 }
+
+// TriggerChatCommand is what map triggers see when a player types in chat, e.g. "-ar" in custom maps.
+type TriggerChatCommand struct {
+	// Unknown1 and Unknown2 seem to be ids of the trigger/event, but this isn't confirmed
+	Unknown1, Unknown2 uint32
+	Text               string
+}
+
+func (c TriggerChatCommand) String() string { return fmt.Sprintf("Trigger chat %q", c.Text) }
+func (TriggerChatCommand) APMChange() int   { return 0 }
+
+// Cheat is a single player cheat code, numbered by its action id.
+type Cheat byte
+
+func (c Cheat) String() string {
+	if name, ok := cheatNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Cheat %#02x", byte(c))
+}
+func (c Cheat) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// CheatUsed is sent when a cheat code is entered, which only works in single player.
+type CheatUsed struct {
+	Cheat Cheat
+	// Arg is the amount for KeyserSoze, LeafitToMe and GreedIsGood, and the raw time of day for DayLightSavings.
+	Arg uint32
+}
+
+// TimeOfDay decodes Arg for DayLightSavings.
+func (c CheatUsed) TimeOfDay() float32 {
+	return math.Float32frombits(c.Arg)
+}
+
+func (c CheatUsed) String() string {
+	switch c.Cheat {
+	case KeyserSoze, LeafitToMe, GreedIsGood:
+		return fmt.Sprintf("Cheat %s %d", c.Cheat, c.Arg)
+	case DayLightSavings:
+		return fmt.Sprintf("Cheat %s %.1f", c.Cheat, c.TimeOfDay())
+	}
+	return fmt.Sprintf("Cheat %s", c.Cheat)
+}
+func (CheatUsed) APMChange() int { return 0 }
+
+type GameCacheKind byte
+
+const (
+	GameCacheInteger GameCacheKind = 0x6B
+	GameCacheReal    GameCacheKind = 0x6C
+	GameCacheBoolean GameCacheKind = 0x6D
+)
+
+func (k GameCacheKind) String() string {
+	switch k {
+	case GameCacheInteger:
+		return "integer"
+	case GameCacheReal:
+		return "real"
+	case GameCacheBoolean:
+		return "boolean"
+	}
+	return fmt.Sprintf("%#02x", byte(k))
+}
+
+// GameCacheSync is sent when a map syncs a stored value in a game cache (SyncStoredInteger and co.).
+// Maps use this to get data out of the game, e.g. W3MMD stats.
+type GameCacheSync struct {
+	Kind       GameCacheKind
+	Filename   string
+	MissionKey string
+	Key        string
+	// Value is the raw value, use Int, Real or Bool depending on Kind
+	Value uint32
+}
+
+func (g GameCacheSync) Int() int32    { return int32(g.Value) }
+func (g GameCacheSync) Real() float32 { return math.Float32frombits(g.Value) }
+func (g GameCacheSync) Bool() bool    { return g.Value != 0 }
+
+func (g GameCacheSync) String() string {
+	return fmt.Sprintf("Sync stored %s %s/%s/%s = %#x", g.Kind, g.Filename, g.MissionKey, g.Key, g.Value)
+}
+func (GameCacheSync) APMChange() int { return 0 }
+
+// RemoveFromQueue is sent when a player cancels a unit or research in a building's production queue.
+type RemoveFromQueue struct {
+	// Slot is the position in the queue, 0 being the one currently in production
+	Slot   int
+	ItemId ItemId
+}
+
+func (r RemoveFromQueue) String() string {
+	return fmt.Sprintf("Cancel %s (queue slot %d)", r.ItemId, r.Slot)
+}
+func (RemoveFromQueue) APMChange() int { return 1 }
+
+type SelectionMode byte
+
+func (m SelectionMode) String() string {
+	switch m {
+	case SelectionAdd:
+		return "Select"
+	case SelectionRemove:
+		return "Deselect"
+	}
+	return fmt.Sprintf("Selection mode %#02x", byte(m))
+}
+
+// ChangeSelection adds or removes objects from the player's current selection.
+// Clicking on a unit is usually sent as removing the old selection and then adding the new one.
+type ChangeSelection struct {
+	Mode    SelectionMode
+	Objects []ObjectHandle
+}
+
+func (c ChangeSelection) String() string {
+	return fmt.Sprintf("%s %d objects %v", c.Mode, len(c.Objects), c.Objects)
+}
+
+// APMChange only counts adding to the selection, since deselecting is sent alongside it for a single click.
+func (c ChangeSelection) APMChange() int {
+	if c.Mode == SelectionAdd {
+		return 1
+	}
+	return 0
+}
+
+// SelectSubgroup is sent when the active subgroup (the unit type whose abilities are shown) changes,
+// e.g. when pressing tab, but also automatically after most selection changes.
+type SelectSubgroup struct {
+	ItemId ItemId
+	Object ObjectHandle
+}
+
+func (s SelectSubgroup) String() string {
+	return fmt.Sprintf("Select subgroup %s %s", s.ItemId, s.Object)
+}
+
+// APMChange is 0 because the game sends this by itself after selecting.
+func (s SelectSubgroup) APMChange() int {
+	return 0
+}
+
+// HotkeyGroup is a control group number as sent by the game, 0-9.
+// Note that group 0 is bound to the 1 key, and group 9 to the 0 key.
+type HotkeyGroup byte
+
+// Key returns the number key the group is bound to.
+func (g HotkeyGroup) Key() int {
+	return (int(g) + 1) % 10
+}
+
+func (g HotkeyGroup) String() string {
+	return fmt.Sprintf("group %d", g.Key())
+}
+
+// AssignGroupHotkey is sent when a player binds their selection to a control group (e.g. ctrl+1).
+type AssignGroupHotkey struct {
+	Group   HotkeyGroup
+	Objects []ObjectHandle
+}
+
+func (a AssignGroupHotkey) String() string {
+	return fmt.Sprintf("Assign %s to %d objects %v", a.Group, len(a.Objects), a.Objects)
+}
+
+func (a AssignGroupHotkey) APMChange() int {
+	return 1
+}
+
+// SelectGroupHotkey is sent when a player recalls a control group.
+// The game only sends the group number, so Objects is filled in from the player's last AssignGroupHotkey for it.
+type SelectGroupHotkey struct {
+	Group   HotkeyGroup
+	Objects []ObjectHandle
+}
+
+func (s SelectGroupHotkey) String() string {
+	return fmt.Sprintf("Select %s", s.Group)
+}
+
+func (s SelectGroupHotkey) APMChange() int {
+	return 1
+}
+
+// UnknownAction is an action that we know the length of, but don't decode (yet).
+// If the action id itself is unknown, Raw holds the rest of the action block, since we can't tell where the next action starts.
+type UnknownAction struct {
+	ID  byte
+	Raw []byte
+}
+
+func (u UnknownAction) String() string {
+	name := "Unknown action"
+	if spec, ok := actionTable[u.ID]; ok {
+		name = spec.name
+	}
+	if len(u.Raw) == 0 {
+		return fmt.Sprintf("%s [%#02x]", name, u.ID)
+	}
+	return fmt.Sprintf("%s [%#02x] % x", name, u.ID, u.Raw)
+}
+
+func (u UnknownAction) APMChange() int {
+	if spec, ok := actionTable[u.ID]; ok && spec.countsForAPM {
+		return 1
+	}
+	return 0
+}
+
 func readActionBlock(buffer *bytes.Buffer, replay *Replay) (Ability, error) {
 	actionId, err := buffer.ReadByte()
 	if err != nil {
 		return nil, err
 	}
+	actionId = normalizeActionId(actionId, replay.Version)
 	switch actionId {
+	case 0x01:
+		return PauseGame{}, nil
+	case 0x02:
+		return ResumeGame{}, nil
+	case 0x03:
+		speed, err := buffer.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		return SetGameSpeed{Speed: GameSpeed(speed)}, nil
+	case 0x04:
+		return IncreaseGameSpeed{}, nil
+	case 0x05:
+		return DecreaseGameSpeed{}, nil
+	case 0x06:
+		filename, err := buffer.ReadString(0)
+		if err != nil {
+			return nil, err
+		}
+		return SaveGame{Filename: strings.TrimRight(filename, "\000")}, nil
+	case 0x07:
+		// unknown, always 0x01
+		if _, err = readDWORD(buffer); err != nil {
+			return nil, err
+		}
+		return SaveGameFinished{}, nil
 	case 0x10, 0x11, 0x12, 0x13, 0x14: // ability (+target) (+object target) (+ target item)
 		var abilityFlags uint16
 		if replay.Version < 13 {
@@ -229,8 +587,201 @@ func readActionBlock(buffer *bytes.Buffer, replay *Replay) (Ability, error) {
 
 		return GiveOrDropItem{objTargetedAbility, ObjectId(itemObjId1), ObjectId(itemObjId2)}, nil
 
+	case 0x16: // change selection
+		mode, err := buffer.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		objects, err := readObjectList(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return ChangeSelection{Mode: SelectionMode(mode), Objects: objects}, nil
+
+	case 0x17: // assign group hotkey
+		group, err := buffer.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		objects, err := readObjectList(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return AssignGroupHotkey{Group: HotkeyGroup(group), Objects: objects}, nil
+
+	case 0x18: // select group hotkey
+		group, err := buffer.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		// unknown, always 0x03
+		if _, err = buffer.ReadByte(); err != nil {
+			return nil, err
+		}
+		return SelectGroupHotkey{Group: HotkeyGroup(group)}, nil
+
+	case 0x19: // select subgroup
+		if replay.Version < 14 {
+			// only the subgroup number was sent before 1.14b
+			break
+		}
+		var itemId [4]byte
+		if _, err = buffer.Read(itemId[:]); err != nil {
+			return nil, err
+		}
+		object, err := readObjectHandle(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return SelectSubgroup{ItemId: itemId, Object: object}, nil
+
+	case 0x1E: // remove unit from building queue
+		slot, err := buffer.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		var itemId [4]byte
+		if _, err = buffer.Read(itemId[:]); err != nil {
+			return nil, err
+		}
+		return RemoveFromQueue{Slot: int(slot), ItemId: itemId}, nil
+
+	case 0x20, 0x22, 0x23, 0x24, 0x25, 0x26, 0x29, 0x2A, 0x2B, 0x2C, 0x2F, 0x30, 0x31, 0x32: // cheats without arguments
+		return CheatUsed{Cheat: Cheat(actionId)}, nil
+
+	case 0x27, 0x28, 0x2D: // cheats that give resources
+		// unknown, always 0xFF
+		if _, err = buffer.ReadByte(); err != nil {
+			return nil, err
+		}
+		amount, err := readDWORD(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return CheatUsed{Cheat: Cheat(actionId), Arg: amount}, nil
+
+	case 0x2E: // DayLightSavings
+		timeOfDay, err := readDWORD(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return CheatUsed{Cheat: Cheat(actionId), Arg: timeOfDay}, nil
+
+	case 0x50: // change ally options
+		slot, err := buffer.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		flags, err := readDWORD(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return ChangeAllyOptions{TargetSlot: int(slot), Options: AllyOptions(flags)}, nil
+
+	case 0x51: // transfer resources
+		slot, err := buffer.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		gold, err := readDWORD(buffer)
+		if err != nil {
+			return nil, err
+		}
+		lumber, err := readDWORD(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return TransferResources{TargetSlot: int(slot), Gold: int(gold), Lumber: int(lumber)}, nil
+
+	case 0x60: // map trigger chat command
+		unknown1, err := readDWORD(buffer)
+		if err != nil {
+			return nil, err
+		}
+		unknown2, err := readDWORD(buffer)
+		if err != nil {
+			return nil, err
+		}
+		text, err := buffer.ReadString(0)
+		if err != nil {
+			return nil, err
+		}
+		return TriggerChatCommand{Unknown1: unknown1, Unknown2: unknown2, Text: strings.TrimRight(text, "\000")}, nil
+
+	case 0x68: // minimap signal
+		target, err := readPointF(buffer)
+		if err != nil {
+			return nil, err
+		}
+		unknown, err := readFloat32(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return MinimapPing{Target: target, Unknown: unknown}, nil
+
+	case 0x6B, 0x6C, 0x6D: // sync stored integer / real / boolean
+		var strs [3]string
+		for i := range strs {
+			str, err := buffer.ReadString(0)
+			if err != nil {
+				return nil, err
+			}
+			strs[i] = strings.TrimRight(str, "\000")
+		}
+		value, err := readDWORD(buffer)
+		if err != nil {
+			return nil, err
+		}
+		return GameCacheSync{
+			Kind:       GameCacheKind(actionId),
+			Filename:   strs[0],
+			MissionKey: strs[1],
+			Key:        strs[2],
+			Value:      value,
+		}, nil
+	}
+	return readUnknownAction(actionId, buffer, replay.Version), nil
+}
+
+func readObjectHandle(buffer *bytes.Buffer) (ObjectHandle, error) {
+	objId1, err := readDWORD(buffer)
+	if err != nil {
+		return ObjectHandle{}, err
+	}
+	objId2, err := readDWORD(buffer)
+	if err != nil {
+		return ObjectHandle{}, err
+	}
+	return ObjectHandle{ObjectId(objId1), ObjectId(objId2)}, nil
+}
+
+// readObjectList reads a WORD count followed by that many object handles
+func readObjectList(buffer *bytes.Buffer) ([]ObjectHandle, error) {
+	n, err := readWORD(buffer)
+	if err != nil {
+		return nil, err
+	}
+	objects := make([]ObjectHandle, 0, n)
+	for i := 0; i < int(n); i++ {
+		object, err := readObjectHandle(buffer)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// readUnknownAction consumes an action we don't have a type for, using actionTable to know how long it is.
+// An id that isn't in actionTable takes the rest of the action block, see readCommandData.
+func readUnknownAction(actionId byte, buffer *bytes.Buffer, version int) UnknownAction {
+	n := buffer.Len()
+	if spec, ok := actionTable[actionId]; ok {
+		if length, ok := spec.payloadLen(buffer.Bytes(), version); ok && length <= n {
+			n = length
+		}
 	}
-	return nil, nil
+	return UnknownAction{ID: actionId, Raw: append([]byte(nil), buffer.Next(n)...)}
 }
 
 // StringsEntity represents a definition from the WC3 *strings.txt files, which tools/gen_strings uses to generate mappings.
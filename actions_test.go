@@ -0,0 +1,174 @@
+package warcrumb
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// readAllActions decodes every action in an action block
+func readAllActions(t *testing.T, rep *Replay, block []byte) []Ability {
+	t.Helper()
+	buf := bytes.NewBuffer(block)
+	var got []Ability
+	for buf.Len() > 0 {
+		ability, err := readActionBlock(buf, rep)
+		if err != nil {
+			t.Fatalf("readActionBlock() error = %v", err)
+		}
+		got = append(got, ability)
+	}
+	return got
+}
+
+// readAction decodes a single action, failing if there's anything left over
+func readAction(t *testing.T, rep *Replay, block []byte) Ability {
+	t.Helper()
+	got := readAllActions(t, rep, block)
+	if len(got) != 1 {
+		t.Fatalf("expected 1 action, got %v", got)
+	}
+	return got[0]
+}
+
+func TestReadActionBlockUnknownActions(t *testing.T) {
+	rep := &Replay{Version: 10032}
+	block := []byte{
+		0x61,                                                 // ESC pressed
+		0x1D, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, // cancel hero revival
+		0x75, 0x03, // arrow key
+		0x66,                                                 // enter hero skill submenu
+		0x64, 0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, // trackable hit
+		0xA1, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, // Reforged
+		0xEE, 0x01, 0x02, 0x03, // something we don't know about
+	}
+	want := []Ability{
+		UnknownAction{ID: 0x61},
+		UnknownAction{ID: 0x1D, Raw: []byte{0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}},
+		UnknownAction{ID: 0x75, Raw: []byte{0x03}},
+		UnknownAction{ID: 0x66},
+		UnknownAction{ID: 0x64, Raw: []byte{0x01, 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00}},
+		UnknownAction{ID: 0xA1, Raw: []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09}},
+		UnknownAction{ID: 0xEE, Raw: []byte{0x01, 0x02, 0x03}},
+	}
+	got := readAllActions(t, rep, block)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readActionBlock() got %v, want %v", got, want)
+	}
+}
+
+func TestNormalizeActionId(t *testing.T) {
+	tests := []struct {
+		id      byte
+		version int
+		want    byte
+	}{
+		{0x1A, 13, 0x1C},
+		{0x1A, 14, 0x1A},
+		{0x1C, 13, 0x1E},
+		{0x1D, 6, 0x1E},
+		{0x1D, 7, 0x1D},
+		{0x65, 6, 0x66},
+		{0x68, 6, 0x69},
+		{0x68, 7, 0x68},
+		{0x10, 1, 0x10},
+	}
+	for _, tt := range tests {
+		if got := normalizeActionId(tt.id, tt.version); got != tt.want {
+			t.Errorf("normalizeActionId(%#02x, %d) = %#02x, want %#02x", tt.id, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestRemoveFromQueueBefore107(t *testing.T) {
+	rep := parseTestReplay(t, "1.01-LeoLaporte_vs_Ghostridah_crazy.w3g")
+	want := RemoveFromQueue{Slot: 0, ItemId: ItemId{'d', 'o', 'k', 'o'}}
+	found := 0
+	for _, action := range rep.Actions {
+		if action.Time < 11*time.Minute+23*time.Second || action.Time >= 11*time.Minute+24*time.Second || action.Player.Name != "LeoLaporte" {
+			continue
+		}
+		if action.Ability != want {
+			t.Errorf("%s: got %#v, want %#v", action.Time, action.Ability, want)
+		}
+		found++
+	}
+	if found == 0 {
+		t.Errorf("no actions by LeoLaporte at 11:23")
+	}
+}
+
+func TestReadActionBlockSelection(t *testing.T) {
+	rep := &Replay{Version: 10032}
+	block := []byte{
+		0x16, 0x02, 0x01, 0x00, 0x10, 0x00, 0x00, 0x00, 0x11, 0x00, 0x00, 0x00, // deselect 1 object
+		0x16, 0x01, 0x02, 0x00, 0x20, 0x00, 0x00, 0x00, 0x21, 0x00, 0x00, 0x00,
+		0x30, 0x00, 0x00, 0x00, 0x31, 0x00, 0x00, 0x00, // select 2 objects
+		0x19, 'a', 'e', 'p', 'h', 0x20, 0x00, 0x00, 0x00, 0x21, 0x00, 0x00, 0x00, // select subgroup
+	}
+	want := []Ability{
+		ChangeSelection{Mode: SelectionRemove, Objects: []ObjectHandle{{0x10, 0x11}}},
+		ChangeSelection{Mode: SelectionAdd, Objects: []ObjectHandle{{0x20, 0x21}, {0x30, 0x31}}},
+		SelectSubgroup{ItemId: ItemId{'a', 'e', 'p', 'h'}, Object: ObjectHandle{0x20, 0x21}},
+	}
+	got := readAllActions(t, rep, block)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readActionBlock() got %v, want %v", got, want)
+	}
+	if got[0].APMChange() != 0 || got[1].APMChange() != 1 || got[2].APMChange() != 0 {
+		t.Errorf("unexpected APMChange() values for %v", got)
+	}
+}
+
+func TestReadActionBlockSaveGame(t *testing.T) {
+	rep := &Replay{Version: 10032}
+	block := []byte{
+		0x06, 'l', 'o', 't', 'r', '.', 'w', '3', 'z', 0x00,
+		0x07, 0x01, 0x00, 0x00, 0x00,
+	}
+	want := []Ability{
+		SaveGame{Filename: "lotr.w3z"},
+		SaveGameFinished{},
+	}
+	if got := readAllActions(t, rep, block); !reflect.DeepEqual(got, want) {
+		t.Errorf("readActionBlock() got %v, want %v", got, want)
+	}
+}
+
+func TestReadActionBlockCheats(t *testing.T) {
+	rep := &Replay{Version: 10032}
+	block := []byte{
+		0x26,                               // WhosYourDaddy
+		0x2D, 0xFF, 0x10, 0x27, 0x00, 0x00, // GreedIsGood 10000
+		0x2E, 0x00, 0x00, 0x40, 0x41, // DayLightSavings 12.0
+	}
+	want := []Ability{
+		CheatUsed{Cheat: WhosYourDaddy},
+		CheatUsed{Cheat: GreedIsGood, Arg: 10000},
+		CheatUsed{Cheat: DayLightSavings, Arg: 0x41400000},
+	}
+	got := readAllActions(t, rep, block)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readActionBlock() got %v, want %v", got, want)
+	}
+	if tod := got[2].(CheatUsed).TimeOfDay(); tod != 12 {
+		t.Errorf("TimeOfDay() = %f, want 12", tod)
+	}
+}
+
+func TestReadActionBlockGameCacheSync(t *testing.T) {
+	rep := &Replay{Version: 10032}
+	block := append([]byte{0x6B}, "MMD.Dat\x00val:0\x00init version 0 1\x00"...)
+	block = append(block, 0x01, 0x00, 0x00, 0x00)
+	want := GameCacheSync{
+		Kind:       GameCacheInteger,
+		Filename:   "MMD.Dat",
+		MissionKey: "val:0",
+		Key:        "init version 0 1",
+		Value:      1,
+	}
+	if got := readAction(t, rep, block); !reflect.DeepEqual(got, want) {
+		t.Errorf("readActionBlock() got %v, want %v", got, want)
+	}
+}
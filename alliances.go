@@ -0,0 +1,84 @@
+package warcrumb
+
+import "time"
+
+// defaultTeamAlliance is what we assume players on the same lobby team start out with.
+// Changes made by map triggers aren't in the replay, so custom maps may differ.
+const defaultTeamAlliance AllyOptions = 0x1F | 0x20 | 0x400
+
+// AllianceChange is a point in time where a player's ally options towards another player changed.
+type AllianceChange struct {
+	Time    time.Duration
+	Options AllyOptions
+}
+
+// AllianceTimeline tracks the ally options one slot has towards another over the course of the game.
+// Alliances aren't necessarily mutual, so there's one timeline for each direction.
+type AllianceTimeline struct {
+	FromSlot int
+	ToSlot   int
+	// Initial is what we assume from the lobby teams
+	Initial AllyOptions
+	Changes []AllianceChange
+}
+
+// At returns the options in effect at time t.
+func (a AllianceTimeline) At(t time.Duration) AllyOptions {
+	options := a.Initial
+	for _, change := range a.Changes {
+		if change.Time > t {
+			break
+		}
+		options = change.Options
+	}
+	return options
+}
+
+// AllianceAt returns the ally options player a had towards player b at time t.
+func (r Replay) AllianceAt(a, b *Player, t time.Duration) AllyOptions {
+	for _, timeline := range r.Alliances {
+		if timeline.FromSlot == a.SlotId && timeline.ToSlot == b.SlotId {
+			return timeline.At(t)
+		}
+	}
+	return r.initialAlliance(a.SlotId, b.SlotId)
+}
+
+func (r Replay) initialAlliance(fromSlot, toSlot int) AllyOptions {
+	if fromSlot < 0 || fromSlot >= len(r.Slots) || toSlot < 0 || toSlot >= len(r.Slots) {
+		return 0
+	}
+	if r.Slots[fromSlot].TeamNumber != r.Slots[toSlot].TeamNumber {
+		return 0
+	}
+	options := defaultTeamAlliance
+	if r.GameOptions.FullSharedUnitControl {
+		options |= 0x40
+	}
+	return options
+}
+
+// buildAllianceTimelines fills in rep.Alliances from ChangeAllyOptions actions, in order of first change
+func buildAllianceTimelines(rep *Replay) {
+	for _, action := range rep.Actions {
+		change, ok := action.Ability.(ChangeAllyOptions)
+		if !ok || action.Player == nil {
+			continue
+		}
+		fromSlot := action.Player.SlotId
+		i := 0
+		for ; i < len(rep.Alliances); i++ {
+			if rep.Alliances[i].FromSlot == fromSlot && rep.Alliances[i].ToSlot == change.TargetSlot {
+				break
+			}
+		}
+		if i == len(rep.Alliances) {
+			rep.Alliances = append(rep.Alliances, AllianceTimeline{
+				FromSlot: fromSlot,
+				ToSlot:   change.TargetSlot,
+				Initial:  rep.initialAlliance(fromSlot, change.TargetSlot),
+			})
+		}
+		rep.Alliances[i].Changes = append(rep.Alliances[i].Changes, AllianceChange{action.Time, change.Options})
+	}
+}
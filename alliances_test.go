@@ -0,0 +1,39 @@
+package warcrumb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAllianceAt(t *testing.T) {
+	rep := Replay{
+		Slots: []Slot{{Id: 0, TeamNumber: 1}, {Id: 1, TeamNumber: 1}, {Id: 2, TeamNumber: 2}},
+	}
+	a, b, c := &Player{SlotId: 0}, &Player{SlotId: 1}, &Player{SlotId: 2}
+	rep.Actions = []Action{
+		{Time: 10 * time.Second, Player: a, Ability: readAction(t, &rep, []byte{0x50, 0x02, 0x3F, 0x04, 0x00, 0x00})},
+		{Time: 20 * time.Second, Player: a, Ability: ChangeAllyOptions{TargetSlot: 1, Options: 0}},
+	}
+	buildAllianceTimelines(&rep)
+
+	tests := []struct {
+		name       string
+		from, to   *Player
+		t          time.Duration
+		allied     bool
+		vision     bool
+		allyVictor bool
+	}{
+		{"teammates at start", a, b, 0, true, true, true},
+		{"teammates after unallying", a, b, 25 * time.Second, false, false, false},
+		{"enemies at start", a, c, 5 * time.Second, false, false, false},
+		{"enemies after allying", a, c, 10 * time.Second, true, true, true},
+		{"not mutual", c, a, 15 * time.Second, false, false, false},
+	}
+	for _, tt := range tests {
+		got := rep.AllianceAt(tt.from, tt.to, tt.t)
+		if got.Allied() != tt.allied || got.SharedVision() != tt.vision || got.AlliedVictory() != tt.allyVictor {
+			t.Errorf("%s: AllianceAt() = %s", tt.name, got)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package warcrumb
+
+import "time"
+
+// CheatEvent is a cheat code entered by a player.
+type CheatEvent struct {
+	Timestamp time.Duration
+	Player    *Player
+	CheatUsed
+}
+
+// CheatsUsed returns every cheat entered during the game, in order.
+// Cheats only work in single player games, i.e. GameType == Singleplayer.
+func (r Replay) CheatsUsed() []CheatEvent {
+	var cheats []CheatEvent
+	for _, action := range r.Actions {
+		if cheat, ok := action.Ability.(CheatUsed); ok {
+			cheats = append(cheats, CheatEvent{action.Time, action.Player, cheat})
+		}
+	}
+	return cheats
+}
@@ -0,0 +1,19 @@
+package warcrumb
+
+import "time"
+
+// CompareChecksums compares the game state checksums of two replays of the same game, saved by different players.
+// If they diverge, it returns the time (in a) of the first checksum that differs, which is when one of the clients desynced.
+// Only the checksums both replays have are compared, since one player may have left earlier.
+func CompareChecksums(a, b Replay) (divergedAt time.Duration, diverged bool) {
+	n := len(a.Checksums)
+	if len(b.Checksums) < n {
+		n = len(b.Checksums)
+	}
+	for i := 0; i < n; i++ {
+		if a.Checksums[i].Value != b.Checksums[i].Value {
+			return a.Checksums[i].Time, true
+		}
+	}
+	return 0, false
+}
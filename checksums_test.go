@@ -0,0 +1,19 @@
+package warcrumb
+
+import "testing"
+
+func TestCompareChecksums(t *testing.T) {
+	rep := parseTestReplay(t, "2pLan.w3g")
+	if len(rep.Checksums) == 0 {
+		t.Fatal("no checksums found")
+	}
+	if _, diverged := CompareChecksums(rep, rep); diverged {
+		t.Error("replay diverged from itself")
+	}
+	desynced := rep
+	desynced.Checksums = append([]ChecksumSample(nil), rep.Checksums[:len(rep.Checksums)/2]...)
+	desynced.Checksums[100].Value++
+	if at, diverged := CompareChecksums(rep, desynced); !diverged || at != rep.Checksums[100].Time {
+		t.Errorf("CompareChecksums() = %s, %t, want %s, true", at, diverged, rep.Checksums[100].Time)
+	}
+}
@@ -1,6 +1,9 @@
 package warcrumb
 
-import "image/color"
+import (
+	"fmt"
+	"image/color"
+)
 
 // colour values from WorldEdit, names from https://gaming-tools.com/warcraft-3/patch-1-29/
 var (
@@ -36,6 +39,8 @@ var (
 	NightElf   = Race{"Night Elf"}
 	Undead     = Race{"Undead"}
 	RandomRace = Race{"Random"}
+	// UnknownRace is for when the replay doesn't say, e.g. Player.QueuedRace outside ladder games
+	UnknownRace = Race{"Unknown"}
 )
 
 var races = map[byte]Race{
@@ -86,6 +91,14 @@ var colors = []Color{
 	Peanut,
 }
 
+// colorByIndex looks up a color, falling back on a made up one (instead of panicking) for indexes past the table
+func colorByIndex(i byte) Color {
+	if int(i) < len(colors) {
+		return colors[i]
+	}
+	return Color{color.Black, fmt.Sprintf("Color %d", i)}
+}
+
 const (
 	EasyAI   AIStrength = 0x00
 	NormalAI            = 0x01
@@ -124,3 +137,102 @@ const (
 	Singleplayer          = 0x1D
 	LadderTeam            = 0x20 // (AT or RT, 2on2/3on3/4on4)
 )
+
+const (
+	TeamsAndRacesSelectable SelectMode = 0x00 // for standard custom games
+	FixedAlliances          SelectMode = 0x01 // teams not selectable (map setting in World Editor)
+	FixedPlayerProperties   SelectMode = 0x03 // teams & races not selectable (map setting in World Editor)
+	RandomRacesFixed        SelectMode = 0x04 // races fixed to random (extended map options)
+	AutomatedMatchMaking    SelectMode = 0xCC // ladder
+)
+
+const (
+	SourceUnknown GameSource = iota
+	SourceLAN
+	SourceClassicCustom // not returned by Replay.Source, as it can't tell these from LAN games
+	SourceClassicLadder
+	SourceReforgedCustom
+	SourceReforgedMatchmaking
+	SourceSingleplayer
+)
+
+const (
+	SelectionAdd    SelectionMode = 0x01
+	SelectionRemove SelectionMode = 0x02
+)
+
+const (
+	TheDudeAbides            Cheat = 0x20
+	SomebodySetUpUsTheBomb   Cheat = 0x22
+	WarpTen                  Cheat = 0x23
+	IocainePowder            Cheat = 0x24
+	PointBreak               Cheat = 0x25
+	WhosYourDaddy            Cheat = 0x26
+	KeyserSoze               Cheat = 0x27
+	LeafitToMe               Cheat = 0x28
+	ThereIsNoSpoon           Cheat = 0x29
+	StrengthAndHonor         Cheat = 0x2A
+	ItVexesMe                Cheat = 0x2B
+	WhoIsJohnGalt            Cheat = 0x2C
+	GreedIsGood              Cheat = 0x2D
+	DayLightSavings          Cheat = 0x2E
+	ISeeDeadPeople           Cheat = 0x2F
+	Synergy                  Cheat = 0x30
+	SharpAndShiny            Cheat = 0x31
+	AllYourBaseAreBelongToUs Cheat = 0x32
+)
+
+var cheatNames = map[Cheat]string{
+	TheDudeAbides:            "TheDudeAbides",
+	SomebodySetUpUsTheBomb:   "SomebodySetUpUsTheBomb",
+	WarpTen:                  "WarpTen",
+	IocainePowder:            "IocainePowder",
+	PointBreak:               "PointBreak",
+	WhosYourDaddy:            "WhosYourDaddy",
+	KeyserSoze:               "KeyserSoze",
+	LeafitToMe:               "LeafitToMe",
+	ThereIsNoSpoon:           "ThereIsNoSpoon",
+	StrengthAndHonor:         "StrengthAndHonor",
+	ItVexesMe:                "itvexesme",
+	WhoIsJohnGalt:            "WhoIsJohnGalt",
+	GreedIsGood:              "GreedIsGood",
+	DayLightSavings:          "DayLightSavings",
+	ISeeDeadPeople:           "ISeeDeadPeople",
+	Synergy:                  "Synergy",
+	SharpAndShiny:            "SharpAndShiny",
+	AllYourBaseAreBelongToUs: "AllYourBaseAreBelongToUs",
+}
+
+const (
+	LeaveRemote        LeaveReason = 0x01
+	LeaveLocal         LeaveReason = 0x0C
+	LeaveRemoteUnknown LeaveReason = 0x0E
+)
+
+const (
+	LeaveDisconnected LeaveResult = 0x01
+	LeaveLeft         LeaveResult = 0x07
+	LeaveLost         LeaveResult = 0x08
+	LeaveWon          LeaveResult = 0x09
+	LeaveDraw         LeaveResult = 0x0A
+	LeaveLeftObserver LeaveResult = 0x0B
+)
+
+const (
+	ResultUnknown PlayerResult = iota
+	ResultWon
+	ResultLost
+	ResultDraw
+	ResultLeft
+	ResultDisconnected
+)
+
+const (
+	CountdownRunning CountdownMode = 0x00
+	CountdownOver    CountdownMode = 0x01
+)
+
+const (
+	RegionAmericas BnetRegion = 10
+	RegionEurope   BnetRegion = 20
+)
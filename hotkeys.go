@@ -0,0 +1,67 @@
+package warcrumb
+
+import (
+	"sort"
+	"time"
+)
+
+// HotkeyStats summarizes how a player used control groups, indexed by HotkeyGroup.
+type HotkeyStats struct {
+	Assigns [10]int
+	Recalls [10]int
+	// RecallsPerMinute is over the whole game
+	RecallsPerMinute float64
+	// MostUsed has the groups that were recalled at least once, most recalled first
+	MostUsed []HotkeyGroup
+}
+
+// HotkeyUsage counts how often the player assigned and recalled each control group.
+func (r Replay) HotkeyUsage(player *Player) HotkeyStats {
+	var stats HotkeyStats
+	totalRecalls := 0
+	for _, action := range r.Actions {
+		if action.Player != player {
+			continue
+		}
+		switch ability := action.Ability.(type) {
+		case AssignGroupHotkey:
+			if ability.Group < 10 {
+				stats.Assigns[ability.Group]++
+			}
+		case SelectGroupHotkey:
+			if ability.Group < 10 {
+				stats.Recalls[ability.Group]++
+				totalRecalls++
+			}
+		}
+	}
+	if r.Duration > 0 {
+		stats.RecallsPerMinute = float64(totalRecalls) / (float64(r.Duration) / float64(time.Minute))
+	}
+	for group, recalls := range stats.Recalls {
+		if recalls > 0 {
+			stats.MostUsed = append(stats.MostUsed, HotkeyGroup(group))
+		}
+	}
+	sort.SliceStable(stats.MostUsed, func(i, j int) bool {
+		return stats.Recalls[stats.MostUsed[i]] > stats.Recalls[stats.MostUsed[j]]
+	})
+	return stats
+}
+
+// resolveHotkeyGroups fills in SelectGroupHotkey.Objects with whatever was last assigned to that group by the same player
+func resolveHotkeyGroups(actions []Action) {
+	groups := make(map[*Player]map[HotkeyGroup][]ObjectHandle)
+	for i, action := range actions {
+		switch ability := action.Ability.(type) {
+		case AssignGroupHotkey:
+			if groups[action.Player] == nil {
+				groups[action.Player] = make(map[HotkeyGroup][]ObjectHandle)
+			}
+			groups[action.Player][ability.Group] = ability.Objects
+		case SelectGroupHotkey:
+			ability.Objects = groups[action.Player][ability.Group]
+			actions[i].Ability = ability
+		}
+	}
+}
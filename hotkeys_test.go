@@ -0,0 +1,26 @@
+package warcrumb
+
+import "testing"
+
+func TestHotkeyUsage(t *testing.T) {
+	rep := parseTestReplay(t, "W3R-22259-Grubby(O) vs Happy(UD).w3g")
+	for _, player := range rep.Players {
+		stats := rep.HotkeyUsage(player)
+		if len(stats.MostUsed) == 0 || stats.RecallsPerMinute <= 0 {
+			t.Errorf("HotkeyUsage(%s) found no recalls: %+v", player, stats)
+			continue
+		}
+		top := stats.MostUsed[0]
+		for _, group := range stats.MostUsed {
+			if stats.Recalls[group] > stats.Recalls[top] {
+				t.Errorf("HotkeyUsage(%s).MostUsed not sorted: %v", player, stats.MostUsed)
+			}
+		}
+	}
+	for _, action := range rep.Actions {
+		if recall, ok := action.Ability.(SelectGroupHotkey); ok && len(recall.Objects) == 0 {
+			t.Errorf("SelectGroupHotkey at %s has no objects, the group should have been assigned first", action.Time)
+			break
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package warcrumb
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mmdFilename is the game cache that W3MMD messages are synced through
+const mmdFilename = "MMD.Dat"
+
+// MMD holds the stats a map reported using the W3MMD protocol (used by DotA-likes and many arena maps).
+// Maps send messages like "VarP 0 kills += 1" through game cache syncs, and this is the result of applying all of them.
+type MMD struct {
+	ProtocolVersion int
+	MinimumVersion  int
+	// Players is indexed by the map's player number, which normally is the Slot.Id
+	Players   map[int]*MMDPlayer
+	VarDefs   map[string]MMDVarDef
+	EventDefs map[string]MMDEventDef
+	Events    []MMDEvent
+	Custom    []string
+}
+
+type MMDPlayer struct {
+	Pid    int
+	Name   string
+	Player *Player
+	// Vars has the final value of each player variable, formatted as the map sent it
+	Vars  map[string]string
+	Flags []string
+}
+
+// Result returns the last of the "winner", "loser" or "drawer" flags the player got, or "" if none.
+func (p MMDPlayer) Result() string {
+	for i := len(p.Flags) - 1; i >= 0; i-- {
+		switch p.Flags[i] {
+		case "winner", "loser", "drawer":
+			return p.Flags[i]
+		}
+	}
+	return ""
+}
+
+// HasFlag reports whether the player was given the flag, e.g. "leaver" or "practicing".
+func (p MMDPlayer) HasFlag(flag string) bool {
+	for _, f := range p.Flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+type MMDVarDef struct {
+	Name string
+	// Type is "int", "real" or "string"
+	Type       string
+	Goal       string
+	Suggestion string
+}
+
+type MMDEventDef struct {
+	Name     string
+	ArgNames []string
+	// Format is how the map wants the event displayed, with {0}, {1}... for args
+	Format string
+}
+
+type MMDEvent struct {
+	Time time.Duration
+	Name string
+	Args []string
+}
+
+// decodeMMD fills in rep.MMD if the map sent any W3MMD messages
+func decodeMMD(rep *Replay) {
+	seen := make(map[string]bool)
+	for _, action := range rep.Actions {
+		sync, ok := action.Ability.(GameCacheSync)
+		if !ok || sync.Kind != GameCacheInteger || sync.Filename != mmdFilename {
+			continue
+		}
+		// every message has an id, and may be sent more than once (e.g. by each player)
+		if !strings.HasPrefix(sync.MissionKey, "val:") || seen[sync.MissionKey] {
+			continue
+		}
+		seen[sync.MissionKey] = true
+		if rep.MMD == nil {
+			rep.MMD = &MMD{
+				Players:   make(map[int]*MMDPlayer),
+				VarDefs:   make(map[string]MMDVarDef),
+				EventDefs: make(map[string]MMDEventDef),
+			}
+		}
+		rep.MMD.apply(rep, action.Time, splitMMDMessage(sync.Key))
+	}
+}
+
+func (m *MMD) apply(rep *Replay, t time.Duration, args []string) {
+	if len(args) == 0 {
+		return
+	}
+	switch args[0] {
+	case "init":
+		if len(args) >= 4 && args[1] == "version" {
+			m.MinimumVersion, _ = strconv.Atoi(args[2])
+			m.ProtocolVersion, _ = strconv.Atoi(args[3])
+		} else if len(args) >= 4 && args[1] == "pid" {
+			if p := m.player(rep, args[2]); p != nil {
+				p.Name = args[3]
+			}
+		}
+	case "DefVarP":
+		if len(args) >= 5 {
+			m.VarDefs[args[1]] = MMDVarDef{Name: args[1], Type: args[2], Goal: args[3], Suggestion: args[4]}
+		}
+	case "VarP":
+		if len(args) >= 5 {
+			if p := m.player(rep, args[1]); p != nil {
+				p.Vars[args[2]] = applyMMDOp(m.VarDefs[args[2]].Type, p.Vars[args[2]], args[3], args[4])
+			}
+		}
+	case "FlagP":
+		if len(args) >= 3 {
+			if p := m.player(rep, args[1]); p != nil {
+				p.Flags = append(p.Flags, args[2])
+			}
+		}
+	case "DefEvent":
+		if len(args) >= 3 {
+			nArgs, _ := strconv.Atoi(args[2])
+			if len(args) >= 3+nArgs {
+				def := MMDEventDef{Name: args[1], ArgNames: args[3 : 3+nArgs]}
+				if len(args) > 3+nArgs {
+					def.Format = args[3+nArgs]
+				}
+				m.EventDefs[args[1]] = def
+			}
+		}
+	case "Event":
+		if len(args) >= 2 {
+			m.Events = append(m.Events, MMDEvent{Time: t, Name: args[1], Args: args[2:]})
+		}
+	case "Custom":
+		m.Custom = append(m.Custom, strings.Join(args[1:], " "))
+	}
+}
+
+// player gets or creates the MMDPlayer for a pid given as a string
+func (m *MMD) player(rep *Replay, pidStr string) *MMDPlayer {
+	pid, err := strconv.Atoi(pidStr)
+	if err != nil {
+		return nil
+	}
+	if p, ok := m.Players[pid]; ok {
+		return p
+	}
+	p := &MMDPlayer{Pid: pid, Vars: make(map[string]string)}
+	if pid >= 0 && pid < len(rep.Slots) {
+		p.Player = rep.Slots[pid].Player
+	}
+	m.Players[pid] = p
+	return p
+}
+
+// applyMMDOp applies "=", "+=" or "-=" to a variable, doing the maths for numeric types
+func applyMMDOp(varType, current, op, operand string) string {
+	if op == "=" || varType == "string" {
+		return operand
+	}
+	if varType == "int" {
+		a, _ := strconv.ParseInt(current, 10, 64)
+		b, err := strconv.ParseInt(operand, 10, 64)
+		if err != nil {
+			return current
+		}
+		if op == "-=" {
+			b = -b
+		}
+		return strconv.FormatInt(a+b, 10)
+	}
+	a, _ := strconv.ParseFloat(current, 64)
+	b, err := strconv.ParseFloat(operand, 64)
+	if err != nil {
+		return current
+	}
+	if op == "-=" {
+		b = -b
+	}
+	return strconv.FormatFloat(a+b, 'f', -1, 64)
+}
+
+// splitMMDMessage splits a message on spaces, where a backslash escapes the next character (so "\ " is a space inside an argument)
+func splitMMDMessage(msg string) []string {
+	var args []string
+	var current strings.Builder
+	escaped := false
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		switch {
+		case escaped:
+			current.WriteByte(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ' ':
+			args = append(args, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	return append(args, current.String())
+}
@@ -0,0 +1,66 @@
+package warcrumb
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDecodeMMD(t *testing.T) {
+	player := &Player{Name: "Grubby", SlotId: 1}
+	rep := Replay{Slots: []Slot{{Id: 0}, {Id: 1, Player: player}}}
+	messages := []string{
+		"init version 0 1",
+		"init pid 1 Grubby",
+		"DefVarP kills int high leaderboard",
+		"DefVarP hero string none none",
+		"DefEvent kill 2 killer victim {0}\\ killed\\ {1}",
+		"VarP 1 kills += 3",
+		"VarP 1 kills -= 1",
+		"VarP 1 hero = Blade\\ Master",
+		"Event kill 1 0",
+		"FlagP 1 winner",
+		"VarP 1 kills += 3", // duplicate id, should be ignored
+	}
+	for i, msg := range messages {
+		id := i
+		if i == len(messages)-1 {
+			id = 5
+		}
+		rep.Actions = append(rep.Actions, Action{
+			Time:   time.Duration(i) * time.Second,
+			Player: player,
+			Ability: GameCacheSync{
+				Kind:       GameCacheInteger,
+				Filename:   mmdFilename,
+				MissionKey: "val:" + strconv.Itoa(id),
+				Key:        msg,
+			},
+		})
+	}
+	decodeMMD(&rep)
+	if rep.MMD == nil {
+		t.Fatal("MMD was not decoded")
+	}
+	if rep.MMD.ProtocolVersion != 1 {
+		t.Errorf("ProtocolVersion = %d, want 1", rep.MMD.ProtocolVersion)
+	}
+	p := rep.MMD.Players[1]
+	if p == nil || p.Player != player || p.Name != "Grubby" {
+		t.Fatalf("unexpected MMD player: %+v", p)
+	}
+	wantVars := map[string]string{"kills": "2", "hero": "Blade Master"}
+	if !reflect.DeepEqual(p.Vars, wantVars) {
+		t.Errorf("Vars = %v, want %v", p.Vars, wantVars)
+	}
+	if p.Result() != "winner" {
+		t.Errorf("Result() = %q, want winner", p.Result())
+	}
+	if def := rep.MMD.EventDefs["kill"]; def.Format != "{0} killed {1}" || len(def.ArgNames) != 2 {
+		t.Errorf("unexpected event def: %+v", def)
+	}
+	if len(rep.MMD.Events) != 1 || !reflect.DeepEqual(rep.MMD.Events[0].Args, []string{"1", "0"}) {
+		t.Errorf("unexpected events: %+v", rep.MMD.Events)
+	}
+}
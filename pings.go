@@ -0,0 +1,39 @@
+package warcrumb
+
+import "time"
+
+// PingEvent is a minimap ping, timestamped like ChatMessage so the two can be merged.
+type PingEvent struct {
+	Timestamp time.Duration
+	Player    *Player
+	Target    PointF
+}
+
+// Pings returns every minimap ping in the game, in order.
+func (r Replay) Pings() []PingEvent {
+	return r.filterPings(func(*Player) bool { return true })
+}
+
+// PlayerPings returns the minimap pings sent by the player.
+func (r Replay) PlayerPings(player *Player) []PingEvent {
+	return r.filterPings(func(p *Player) bool { return p == player })
+}
+
+// TeamPings returns the minimap pings sent by anyone on the team (as numbered in Slot.TeamNumber).
+func (r Replay) TeamPings(team int) []PingEvent {
+	return r.filterPings(func(p *Player) bool {
+		return p.SlotId < len(r.Slots) && r.Slots[p.SlotId].TeamNumber == team
+	})
+}
+
+func (r Replay) filterPings(keep func(*Player) bool) []PingEvent {
+	var pings []PingEvent
+	for _, action := range r.Actions {
+		ping, ok := action.Ability.(MinimapPing)
+		if !ok || action.Player == nil || !keep(action.Player) {
+			continue
+		}
+		pings = append(pings, PingEvent{Timestamp: action.Time, Player: action.Player, Target: ping.Target})
+	}
+	return pings
+}
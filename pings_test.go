@@ -0,0 +1,14 @@
+package warcrumb
+
+import "testing"
+
+func TestPings(t *testing.T) {
+	rep := parseTestReplay(t, "secondwin.w3g")
+	all, team1, team2 := rep.Pings(), rep.TeamPings(1), rep.TeamPings(2)
+	if len(all) != 15 || len(team1) != 12 || len(team2) != 3 {
+		t.Errorf("got %d pings (%d team 1, %d team 2), want 15 (12, 3)", len(all), len(team1), len(team2))
+	}
+	if got := rep.PlayerPings(all[0].Player); len(got) != 12 {
+		t.Errorf("PlayerPings(%s) got %d pings, want 12", all[0].Player, len(got))
+	}
+}
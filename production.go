@@ -0,0 +1,119 @@
+package warcrumb
+
+import (
+	"strings"
+	"time"
+)
+
+// ProductionOrder is a unit, hero or research that a player queued in a building.
+type ProductionOrder struct {
+	Time     time.Duration
+	ItemId   ItemId
+	Building ObjectHandle // the building's handle, as far as we can tell from the player's selection
+	// Cancelled is set if a matching RemoveFromQueue was sent for this order later on
+	Cancelled   bool
+	CancelledAt time.Duration
+}
+
+// Production returns the player's production orders, with the ones that were taken out of the queue marked as Cancelled.
+//
+// Each building's queue is tracked from the orders given while it was selected. The replay doesn't say when
+// queued items finish, so a RemoveFromQueue is matched to the latest order with its item id that can be at its slot,
+// taking the orders before that to be finished.
+// A cancel that can't be matched like that, e.g. because the order was given with several buildings selected
+// and went to another one, is left out rather than guessed.
+func (r Replay) Production(player *Player) []ProductionOrder {
+	var orders []ProductionOrder
+	queues := make(map[ObjectHandle][]int) // indexes into orders, by building
+	var selection []ObjectHandle
+	var building ObjectHandle
+	for _, action := range r.Actions {
+		if action.Player != player {
+			continue
+		}
+		switch ability := action.Ability.(type) {
+		case ChangeSelection:
+			selection = applySelectionChange(selection, ability)
+			building = firstObject(selection)
+		case SelectGroupHotkey:
+			selection = append(selection[:0], ability.Objects...)
+			building = firstObject(selection)
+		case SelectSubgroup:
+			building = ability.Object
+		case BasicAbility:
+			if isProductionItem(ability.ItemId) {
+				queues[building] = append(queues[building], len(orders))
+				orders = append(orders, ProductionOrder{Time: action.Time, ItemId: ability.ItemId, Building: building})
+			}
+		case RemoveFromQueue:
+			// the queue shown is the active building's, but look at the rest of the selection in case the order went there
+			for _, b := range append([]ObjectHandle{building}, selection...) {
+				if i, ok := cancelFromQueue(queues, b, orders, ability); ok {
+					orders[i].Cancelled = true
+					orders[i].CancelledAt = action.Time
+					break
+				}
+			}
+		}
+	}
+	return orders
+}
+
+// cancelFromQueue finds the order in the building's queue that the RemoveFromQueue is about and takes it out,
+// along with the orders before it, which must have finished by then.
+func cancelFromQueue(queues map[ObjectHandle][]int, building ObjectHandle, orders []ProductionOrder, remove RemoveFromQueue) (int, bool) {
+	queue := queues[building]
+	// a cancel is usually for something that was just queued, so assume as many orders as possible have finished
+	for finished := len(queue) - remove.Slot - 1; finished >= 0; finished-- {
+		i := queue[finished+remove.Slot]
+		if orders[i].ItemId != remove.ItemId {
+			continue
+		}
+		rest := append([]int(nil), queue[finished:finished+remove.Slot]...)
+		queues[building] = append(rest, queue[finished+remove.Slot+1:]...)
+		return i, true
+	}
+	return 0, false
+}
+
+// BuildOrder is the player's production with the cancelled orders left out.
+func (r Replay) BuildOrder(player *Player) []ProductionOrder {
+	var buildOrder []ProductionOrder
+	for _, order := range r.Production(player) {
+		if !order.Cancelled {
+			buildOrder = append(buildOrder, order)
+		}
+	}
+	return buildOrder
+}
+
+// isProductionItem is whether an ability with no target is something that goes in a building's queue,
+// i.e. training a unit or hero, researching an upgrade, or upgrading the building itself.
+func isProductionItem(id ItemId) bool {
+	code, ok := id.Code()
+	if !ok {
+		// order ids
+		return false
+	}
+	if code[0] == 'R' {
+		// researches
+		return true
+	}
+	full, ok := WC3Strings[code]
+	if !ok {
+		return false
+	}
+	for _, prefix := range []string{"Train ", "Summon ", "Upgrade "} {
+		if strings.HasPrefix(full.Tip, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func firstObject(objects []ObjectHandle) ObjectHandle {
+	if len(objects) == 0 {
+		return ObjectHandle{}
+	}
+	return objects[0]
+}
@@ -0,0 +1,45 @@
+package warcrumb
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProduction(t *testing.T) {
+	rep := parseTestReplay(t, "FirstWin.w3g")
+	type cancel struct {
+		code               string
+		ordered, cancelled time.Duration
+	}
+	ms := func(m, s, ms int) time.Duration {
+		return time.Duration(m)*time.Minute + time.Duration(s)*time.Second + time.Duration(ms)*time.Millisecond
+	}
+	want := map[string][]cancel{
+		// the second of these is cancelled first, so it has to be matched on its slot as well as its item id
+		"comfyblanket#1856": {
+			{"esen", ms(7, 16, 497), ms(7, 19, 148)},
+			{"esen", ms(7, 16, 643), ms(7, 18, 771)},
+			{"esen", ms(7, 21, 272), ms(7, 22, 280)},
+		},
+		"eSprim#2758": {
+			{"Rhri", ms(7, 48, 805), ms(9, 1, 184)},
+		},
+	}
+	for _, player := range rep.Players {
+		production := rep.Production(player)
+		var got []cancel
+		for _, order := range production {
+			if order.Cancelled {
+				code, _ := order.ItemId.Code()
+				got = append(got, cancel{code, order.Time, order.CancelledAt})
+			}
+		}
+		if !reflect.DeepEqual(got, want[player.String()]) {
+			t.Errorf("%s cancelled %+v, want %+v", player, got, want[player.String()])
+		}
+		if n := len(rep.BuildOrder(player)); n != len(production)-len(got) {
+			t.Errorf("BuildOrder(%s) has %d orders, want %d", player, n, len(production)-len(got))
+		}
+	}
+}
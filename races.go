@@ -0,0 +1,80 @@
+package warcrumb
+
+// raceFromFlags decodes the race flags of a ladder player record, ignoring the "selectable or fixed" bit
+func raceFromFlags(flags uint32) (Race, bool) {
+	race, ok := races[byte(flags&0x3F)]
+	return race, ok
+}
+
+// resolveAssignedRaces fills in Player.AssignedRace, which is the slot's race unless the player went random,
+// in which case it's worked out from what they built and selected.
+func resolveAssignedRaces(rep *Replay) {
+	votes := make(map[*Player]map[Race]int)
+	for _, action := range rep.Actions {
+		id, ok := abilityItemId(action.Ability)
+		if !ok {
+			continue
+		}
+		if race, ok := raceOfItem(id); ok {
+			if votes[action.Player] == nil {
+				votes[action.Player] = make(map[Race]int)
+			}
+			votes[action.Player][race]++
+		}
+	}
+	for _, player := range rep.Players {
+		player.AssignedRace = player.slot.Race
+		if player.AssignedRace != RandomRace {
+			continue
+		}
+		// the odd enemy unit can be selected too, so go with the race seen the most
+		most := 0
+		for _, race := range []Race{Human, Orc, NightElf, Undead} {
+			if votes[player][race] > most {
+				most = votes[player][race]
+				player.AssignedRace = race
+			}
+		}
+	}
+}
+
+func abilityItemId(ability Ability) (ItemId, bool) {
+	switch a := ability.(type) {
+	case BasicAbility:
+		return a.ItemId, true
+	case TargetedAbility:
+		return a.ItemId, true
+	case ObjectTargetedAbility:
+		return a.ItemId, true
+	case TwoTargetTwoItemAbility:
+		return a.ItemId, true
+	case SelectSubgroup:
+		return a.ItemId, true
+	}
+	return ItemId{}, false
+}
+
+// raceOfItem says which race a unit, hero, building or upgrade is from, going by its code
+// (e.g. "hpea" and "Hpal" are human, "Rhde" is a human upgrade).
+// Neutral units, abilities and items don't have a race.
+func raceOfItem(id ItemId) (Race, bool) {
+	code, ok := id.Code()
+	if !ok {
+		return Race{}, false
+	}
+	c := code[0]
+	if c == 'R' {
+		c = code[1]
+	}
+	switch c {
+	case 'h', 'H':
+		return Human, true
+	case 'o', 'O':
+		return Orc, true
+	case 'e', 'E':
+		return NightElf, true
+	case 'u', 'U':
+		return Undead, true
+	}
+	return Race{}, false
+}
@@ -0,0 +1,37 @@
+package warcrumb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLadderPlayerRecord(t *testing.T) {
+	rep := parseTestReplay(t, "1.18-replayspl_4105_MKpowa_KrawieC..w3g")
+	for _, p := range rep.Players {
+		if p.ClientRuntime < time.Hour {
+			t.Errorf("%s: ClientRuntime = %s", p.Name, p.ClientRuntime)
+		}
+		switch p.Name {
+		case "MKpowa":
+			if p.QueuedRace != RandomRace || p.AssignedRace != Orc {
+				t.Errorf("MKpowa queued as %s and played %s, want Random and Orc", p.QueuedRace, p.AssignedRace)
+			}
+		case "KrawieC.":
+			if p.QueuedRace != NightElf || p.AssignedRace != NightElf {
+				t.Errorf("KrawieC. queued as %s and played %s, want Night Elf", p.QueuedRace, p.AssignedRace)
+			}
+		}
+	}
+}
+
+func TestQueuedRaceNotLadder(t *testing.T) {
+	rep := parseTestReplay(t, "W3R-22259-Grubby(O) vs Happy(UD).w3g", LobbyOnly())
+	for _, p := range rep.Players {
+		if p.QueuedRace != UnknownRace || p.QueuedRace.ShortName() != "?" {
+			t.Errorf("%s: QueuedRace = %s (%s), want Unknown", p.Name, p.QueuedRace, p.QueuedRace.ShortName())
+		}
+	}
+	if got := (Race{}).ShortName(); got != "?" {
+		t.Errorf("Race{}.ShortName() = %q, want ?", got)
+	}
+}
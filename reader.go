@@ -18,8 +18,10 @@ package warcrumb
 
 import (
 	"bytes"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
 	"math/bits"
@@ -29,18 +31,38 @@ import (
 )
 
 // ParseReplayDebug is the same as ParseReplay but dumps binaries and prints to stdout too
-func ParseReplayDebug(file io.Reader) (rep Replay, err error) {
-	rep.parseOptions.debugMode = true
-	err = read(file, &rep)
-	return rep, err
+func ParseReplayDebug(file io.Reader, options ...ParseOption) (rep Replay, err error) {
+	return ParseReplay(file, append(options, func(o *parseOptions) { o.debugMode = true })...)
 }
 
 // ParseReplay parses an opened .w3g file.
-func ParseReplay(file io.Reader) (rep Replay, err error) {
+func ParseReplay(file io.Reader, options ...ParseOption) (rep Replay, err error) {
+	for _, option := range options {
+		option(&rep.parseOptions)
+	}
 	err = read(file, &rep)
 	return rep, err
 }
 
+// ParseOption changes how much of a replay is parsed, or how.
+type ParseOption func(*parseOptions)
+
+// LobbyOnly stops parsing after the GameStartRecord, so only the header, game options, players and slots are filled in.
+// Only as many blocks are decompressed as the lobby needs, which is usually just the first one,
+// so this is much faster for indexing lots of replays.
+func LobbyOnly() ParseOption {
+	return func(o *parseOptions) {
+		o.lobbyOnly = true
+	}
+}
+
+// RevealPassword fills in GameOptions.Password, which is left out by default so it doesn't get published by accident.
+func RevealPassword() ParseOption {
+	return func(o *parseOptions) {
+		o.revealPassword = true
+	}
+}
+
 func read(file io.Reader, rep *Replay) (err error) {
 	header, err := readHeader(file)
 	if err != nil {
@@ -54,15 +76,23 @@ func read(file io.Reader, rep *Replay) (err error) {
 
 	rep.isReforged = rep.Version >= 10032
 
+	rep.Integrity.HeaderChecksumOK = header.ChecksumValid()
+	if rep.lobbyOnly {
+		return readLobbyBlocks(file, header, rep)
+	}
+	rep.Integrity.ExpectedDecompressedSize = int(header.DecompressedSize)
+
 	// might as well allocate the right size buffer based on the assumption that every block is 8K
 	buffer := bytes.NewBuffer(make([]byte, 0, header.NumberOfBlocks*0x2000))
 	for i := 0; i < int(header.NumberOfBlocks); i++ {
-		b, err := readCompressedBlock(file, rep.isReforged)
+		b, blockIntegrity, err := readCompressedBlock(file, rep.isReforged)
 		if err != nil {
 			return fmt.Errorf("failed to decompress block i=%d: %w", i, err)
 		}
+		rep.Integrity.Blocks = append(rep.Integrity.Blocks, blockIntegrity)
 		buffer.Write(b)
 	}
+	rep.Integrity.DecompressedSize = buffer.Len()
 	bufferCopy := make([]byte, buffer.Len())
 	copy(bufferCopy, buffer.Bytes())
 
@@ -76,11 +106,50 @@ func read(file io.Reader, rep *Replay) (err error) {
 		readBytes := bufferLen - buffer.Len()
 		return fmt.Errorf("error in decompressed data at/before %#x: %w", readBytes, err)
 	}
+	resolveHotkeyGroups(rep.Actions)
 
 	return
 }
 
-func readHeader(file io.Reader) (header header, err error) {
+// readLobbyBlocks decompresses one block at a time until there's enough data to read the lobby,
+// so the rest of the blocks are never inflated
+func readLobbyBlocks(file io.Reader, header ReplayHeader, rep *Replay) error {
+	var data []byte
+	for i := 0; i < int(header.NumberOfBlocks); i++ {
+		b, blockIntegrity, err := readCompressedBlock(file, rep.isReforged)
+		if err != nil {
+			return fmt.Errorf("failed to decompress block i=%d: %w", i, err)
+		}
+		rep.Integrity.Blocks = append(rep.Integrity.Blocks, blockIntegrity)
+		data = append(data, b...)
+
+		// parse into a copy so a failed attempt doesn't leave anything half filled in
+		attempt := *rep
+		buffer := bytes.NewBuffer(data)
+		err = readLobby(buffer, &attempt)
+		if err == nil {
+			*rep = attempt
+			return nil
+		}
+		if buffer.Len() > 0 || i == int(header.NumberOfBlocks)-1 {
+			// didn't run out of data, so it's not because the lobby continues in the next block
+			return fmt.Errorf("error in decompressed data at/before %#x: %w", len(data)-buffer.Len(), err)
+		}
+	}
+	return fmt.Errorf("replay has no data blocks")
+}
+
+// ReadHeader reads just the header of a .w3g file, without decompressing any of the replay data.
+// This is much faster than ParseReplay for when only the version, duration, etc. are needed.
+func ReadHeader(file io.Reader) (ReplayHeader, error) {
+	return readHeader(file)
+}
+
+func readHeader(file io.Reader) (header ReplayHeader, err error) {
+	// keep the raw bytes to check the header's CRC at the end
+	var rawHeader bytes.Buffer
+	file = io.TeeReader(file, &rawHeader)
+
 	magicString := make([]byte, 28)
 	if _, err = file.Read(magicString); err != nil {
 		return header, fmt.Errorf("error reading magic string: %w", err)
@@ -101,23 +170,25 @@ func readHeader(file io.Reader) (header header, err error) {
 	}
 	header.Length = headerSize
 
-	_, err = readDWORD(file)
+	compressedSize, err := readDWORD(file)
 	if err != nil {
 		return header, fmt.Errorf("error reading compressed file size: %w", err)
 	}
+	header.CompressedSize = compressedSize
 
 	replayHeaderVersion, err := readDWORD(file)
 	if err != nil {
-		return header, fmt.Errorf("error reading compressed file size: %w", err)
+		return header, fmt.Errorf("error reading replay header version: %w", err)
 	}
 	if replayHeaderVersion > 0x01 {
-		fmt.Printf("Warning: unexpected replay header version: 0x%x\n", headerSize)
+		fmt.Printf("Warning: unexpected replay header version: 0x%x\n", replayHeaderVersion)
 	}
 
-	_, err = readDWORD(file)
+	decompressedSize, err := readDWORD(file)
 	if err != nil {
 		return header, fmt.Errorf("error reading decompressed data size: %w", err)
 	}
+	header.DecompressedSize = decompressedSize
 	nBlocks, err := readDWORD(file)
 	if err != nil {
 		return header, fmt.Errorf("error reading number of compressed blocks: %w", err)
@@ -148,6 +219,7 @@ func readHeader(file io.Reader) (header header, err error) {
 			return header, fmt.Errorf("error reading flags: %w", err)
 		}
 
+		header.Flags = flags
 		header.IsMultiplayer = flags == 0x8000
 
 		lenMS, err := readDWORD(file)
@@ -156,10 +228,11 @@ func readHeader(file io.Reader) (header header, err error) {
 		}
 		header.Duration = time.Millisecond * time.Duration(lenMS)
 
-		_, err = readDWORD(file)
+		checksum, err := readDWORD(file)
 		if err != nil {
 			return header, fmt.Errorf("error reading checksum: %w", err)
 		}
+		header.Checksum = checksum
 	} else if replayHeaderVersion == 0x1 {
 		versionId, err := readLittleEndianString(file, 4)
 		if err != nil {
@@ -188,6 +261,7 @@ func readHeader(file io.Reader) (header header, err error) {
 			return header, fmt.Errorf("error reading flags: %w", err)
 		}
 
+		header.Flags = flags
 		header.IsMultiplayer = flags == 0x8000
 
 		lenMS, err := readDWORD(file)
@@ -196,24 +270,31 @@ func readHeader(file io.Reader) (header header, err error) {
 		}
 		header.Duration = time.Millisecond * time.Duration(lenMS)
 
-		_, err = readDWORD(file)
+		checksum, err := readDWORD(file)
 		if err != nil {
 			return header, fmt.Errorf("error reading checksum: %w", err)
 		}
+		header.Checksum = checksum
 
 	} else {
 		return header, fmt.Errorf("unsupported header version: 0x%x", replayHeaderVersion)
 	}
+
+	// the checksum is calculated with the checksum field itself zeroed
+	raw := rawHeader.Bytes()
+	copy(raw[len(raw)-4:], []byte{0, 0, 0, 0})
+	header.computedChecksum = crc32.ChecksumIEEE(raw)
 	return header, nil
 }
 
-func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
-
+// readLobby reads everything before the ReplayData blocks: the host, game options, player records and the GameStartRecord
+func readLobby(buffer *bytes.Buffer, rep *Replay) error {
 	_, err := readDWORD(buffer)
 	if err != nil {
 		return fmt.Errorf("error reading unknown field: %w", err)
 	}
 	playerRecords := make(map[int]*playerRecord)
+	cosmetics := make(map[int]Cosmetics) // by player id, as they may come before the playerRecord
 	// [playerRecord]
 	if err = expectByte(buffer, 0); err != nil {
 		return err
@@ -231,18 +312,23 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 	rep.GameOptions.GameName = strings.TrimRight(gameName, "\000")
 
 	// skip null byte normally, but this can also be... "hunter2". srsly
+	// (it's the lobby's password)
 	if b, err := buffer.ReadByte(); err != nil {
 		return err
 	} else if b != 0 {
 		str, err := buffer.ReadString(0)
 		if err != nil {
-			return fmt.Errorf("error reading mystery string: %w", err)
+			return fmt.Errorf("error reading password: %w", err)
 		}
+		rep.GameOptions.HasPassword = true
 
 		// add the byte we removed back to the beginning
-		if rep.debugMode {
-			str = strings.TrimRight(string(append([]byte{b}, str...)), "\000")
-			fmt.Println("mystery string:", str)
+		str = strings.TrimRight(string(append([]byte{b}, str...)), "\000")
+		if rep.revealPassword {
+			rep.GameOptions.Password = str
+			if rep.debugMode {
+				fmt.Println("password:", str)
+			}
 		}
 	}
 
@@ -276,8 +362,9 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 		return fmt.Errorf("error reading private flag: %w", err)
 	}
 	//fmt.Printf("private flag: 0x%x\n", privateFlag)
+	rep.privateFlag = privateFlag
 	rep.PrivateGame = privateFlag == 0x08 || privateFlag == 0xc8
-	// TODO: this can also be 0x20 (in reforged public custom game) or 0x40 (reforged matchmaking)
+	// this can also be 0x20 (in reforged public custom game) or 0x40 (reforged matchmaking), see Replay.Source
 
 	if err = expectWORD(buffer, 0); err != nil {
 		var unexpectedValueError UnexpectedValueError
@@ -322,18 +409,28 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 				return fmt.Errorf("error reading value bnet section kind: %w", err)
 			}
 			if after39 == 4 || after39 == 5 {
-				// some sort of bonus data that needs further investigation
-
-				// now, online games seem to have this at 0 while LAN ones have 2 sometimes
-				bonusDataLength, err := readDWORD(buffer)
+				// protobuf records about a player's skins (4) and other cosmetics (5). These are often empty
+				// (withDKskin.w3g has a DK skin equipped and still an empty kind 4 record), and what's in them
+				// isn't decoded yet beyond the player id, so they're kept raw.
+				cosmeticsLength, err := readDWORD(buffer)
 				if err != nil {
-					return fmt.Errorf("error reading bnet bonus data length: %w", err)
+					return fmt.Errorf("error reading bnet cosmetics length: %w", err)
 				}
-				// not sure how to use the following data so skip it for now
-				bonusData := make([]byte, bonusDataLength)
-				_, err = buffer.Read(bonusData)
-				if err != nil {
-					return fmt.Errorf("error reading bonus data: %w", err)
+				cosmeticsData := make([]byte, cosmeticsLength)
+				if _, err = io.ReadFull(buffer, cosmeticsData); err != nil {
+					return fmt.Errorf("error reading cosmetics: %w", err)
+				}
+				if cosmeticsLength > 0 {
+					playerId, err := readCosmeticsPlayerId(cosmeticsData)
+					if err != nil {
+						return fmt.Errorf("error reading cosmetics: %w", err)
+					}
+					c := cosmetics[playerId]
+					if c.Unknown == nil {
+						c.Unknown = make(map[byte][]byte)
+					}
+					c.Unknown[after39] = append(c.Unknown[after39], cosmeticsData...)
+					cosmetics[playerId] = c
 				}
 			} else if after39 == 3 {
 				lengthOfBnetBlock, err := readDWORD(buffer)
@@ -342,7 +439,7 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 				}
 				// and indeed if we just read the rest of the bnet block, we go straight to GameStartRecord
 				bnetBlock := make([]byte, lengthOfBnetBlock)
-				_, err = buffer.Read(bnetBlock)
+				_, err = io.ReadFull(buffer, bnetBlock)
 				if err != nil {
 					return fmt.Errorf("error reading bnet2.0 block: %w", err)
 				}
@@ -447,11 +544,17 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 			return err
 		} else {
 			slotRecord.TeamNumber = int(teamNumber) + 1 // inside warcrumb teams are 1 indexed!!!
+			// observers and referees get put on the team after the last playable one (12 teams before 1.29, 24 after)
+			if rep.Version >= 29 {
+				slotRecord.IsObserver = slotRecord.TeamNumber == 25
+			} else {
+				slotRecord.IsObserver = slotRecord.TeamNumber == 13
+			}
 		}
 		if color, err := buffer.ReadByte(); err != nil {
 			return err
 		} else {
-			slotRecord.Color = colors[color]
+			slotRecord.Color = colorByIndex(color)
 		}
 
 		if playerRace, err := buffer.ReadByte(); err != nil {
@@ -500,8 +603,18 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 			SlotId:    pRec.SlotId,
 			BattleNet: pRec.Bnet2Acc,
 			Name:      pRec.Name,
+			Cosmetics: cosmetics[id],
 			slot:      &rep.Slots[pRec.SlotId],
 		}
+		rep.Players[id].QueuedRace = UnknownRace
+		if pRec.hasLadderData {
+			rep.Players[id].ClientRuntime = time.Duration(pRec.RuntimeMS) * time.Millisecond
+			rep.Players[id].RaceFlags = pRec.RaceFlags
+			if race, ok := raceFromFlags(pRec.RaceFlags); ok {
+				rep.Players[id].QueuedRace = race
+			}
+		}
+		rep.Players[id].AssignedRace = rep.Slots[pRec.SlotId].Race
 	}
 
 	for i, slot := range rep.Slots {
@@ -529,24 +642,20 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 	if selectMode, err := buffer.ReadByte(); err != nil {
 		return fmt.Errorf("error reading select mode: %w", err)
 	} else {
-		rep.selectMode = selectMode
-		// TODO
-		/*
-		   0x00 - team & race selectable (for standard custom games)
-		   0x01 - team not selectable
-		          (map setting: fixed alliances in WorldEditor)
-		   0x03 - team & race not selectable
-		          (map setting: fixed player properties in WorldEditor)
-		   0x04 - race fixed to random
-		          (extended map options: random races selected)
-		   0xcc - Automated Match Making (ladder)
-		*/
+		rep.SelectMode = SelectMode(selectMode)
 	}
 
 	if startSpotCount, err := buffer.ReadByte(); err != nil {
 		return fmt.Errorf("error reading start spot count: %w", err)
 	} else {
-		rep.startSpotCount = int(startSpotCount)
+		rep.StartSpotCount = int(startSpotCount)
+	}
+	return nil
+}
+
+func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
+	if err := readLobby(buffer, rep); err != nil {
+		return err
 	}
 
 	zeroes := 0
@@ -594,13 +703,20 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 			}
 			inc := unknown > leaveUnknown
 			leaveUnknown = unknown
-			playerRecords[int(playerId)].leaveTime = currentTimeMS
+			leaveTime := time.Duration(currentTimeMS) * time.Millisecond
 			curPlayer := rep.Players[int(playerId)]
+			curPlayer.LeftAt = leaveTime
+			rep.Leaves = append(rep.Leaves, LeaveEvent{
+				Player: curPlayer,
+				Time:   leaveTime,
+				Reason: LeaveReason(reason),
+				Result: LeaveResult(result),
+			})
 
 			// last leave action is by the saver
 			if numLeaves == len(rep.Players) {
 				rep.Saver = curPlayer
-				if saverWon {
+				if saverWon && !rep.Saver.slot.IsObserver {
 					rep.WinnerTeam = rep.Saver.slot.TeamNumber
 				}
 			}
@@ -611,7 +727,9 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 			case 0x01, 0x0E:
 				switch result {
 				case 0x09:
-					rep.WinnerTeam = curPlayer.slot.TeamNumber
+					if !curPlayer.slot.IsObserver {
+						rep.WinnerTeam = curPlayer.slot.TeamNumber
+					}
 				}
 			case 0x0C:
 				if rep.Saver == nil { // "not last"
@@ -621,7 +739,8 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 					case 0x0A:
 						rep.WinnerTeam = -1 // draw
 					}
-				} else { // last local leave action => curPlayer == rep.Saver
+				} else if !rep.Saver.slot.IsObserver { // last local leave action => curPlayer == rep.Saver
+					// (an observer saver's result says nothing about who won)
 					switch result {
 					case 0x07, 0x0B:
 						if inc {
@@ -663,41 +782,8 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 			if _, err := buffer.Read(commandDataBlock); err != nil {
 				return fmt.Errorf("error reading commanddata block: %w", err)
 			}
-			commandDataBuf := bytes.NewBuffer(commandDataBlock)
-			for commandDataBuf.Len() > 0 {
-				var player *Player
-				if playerId, err := commandDataBuf.ReadByte(); err != nil {
-					return fmt.Errorf("error reading CommandData playerId: %w", err)
-				} else {
-					player = rep.Players[int(playerId)]
-				}
-				actionBlockLen, err := readWORD(commandDataBuf)
-				if err != nil {
-					return fmt.Errorf("error reading action block len: %w", err)
-				}
-				actionBlockBytes := make([]byte, actionBlockLen)
-				if _, err := commandDataBuf.Read(actionBlockBytes); err != nil {
-					return fmt.Errorf("error reading action block: %w", err)
-				}
-				actionBlockBuf := bytes.NewBuffer(actionBlockBytes)
-				for actionBlockBuf.Len() > 0 {
-					actionable, err := readActionBlock(actionBlockBuf, rep)
-					if err != nil {
-						if err == io.EOF {
-							// FIXME: this is just so we don't crash from unimplemented actions
-							break
-						}
-						return fmt.Errorf("error parsing action block: %w", err)
-					}
-					action := Action{
-						Ability: actionable,
-						Time:    time.Duration(currentTimeMS) * time.Millisecond,
-						Player:  player,
-					}
-					if action.Ability != nil {
-						rep.Actions = append(rep.Actions, action)
-					}
-				}
+			if err := readCommandData(bytes.NewBuffer(commandDataBlock), rep, time.Duration(currentTimeMS)*time.Millisecond); err != nil {
+				return err
 			}
 
 		case 0x20: //chat message
@@ -744,12 +830,18 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 				Body:        msg,
 				Destination: dest,
 			})
-		case 0x22: //checksum?
+		case 0x22: // checksum of the game state
 			n, err := buffer.ReadByte()
 			if err != nil {
 				return fmt.Errorf("error reading checksum block len: %w", err)
 			}
-			buffer.Next(int(n))
+			checksumBytes := buffer.Next(int(n))
+			if len(checksumBytes) >= 4 {
+				rep.Checksums = append(rep.Checksums, ChecksumSample{
+					Time:  time.Duration(currentTimeMS) * time.Millisecond,
+					Value: binary.LittleEndian.Uint32(checksumBytes),
+				})
+			}
 		case 0x23: //unknown
 			buffer.Next(10)
 		case 0x2F: // forced game end countdown (map is revealed)
@@ -761,10 +853,18 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 			if err != nil {
 				return fmt.Errorf("error reading game end cd secs: %w", err)
 			}
-			// TODO
 			if rep.debugMode {
 				fmt.Printf("countdown mode %x, %d\n", mode, countdownSecs)
 			}
+			now := time.Duration(currentTimeMS) * time.Millisecond
+			if rep.EndCountdown == nil {
+				// the first block has the length of the countdown, later ones may not
+				rep.EndCountdown = &EndCountdown{Seconds: int(countdownSecs), StartedAt: now}
+			}
+			rep.EndCountdown.Mode = CountdownMode(mode)
+			if rep.EndCountdown.Mode == CountdownOver {
+				rep.EndCountdown.EndedAt = now
+			}
 		default:
 			if rep.debugMode {
 				fmt.Printf("unknown block id: 0x%X\n", blockId)
@@ -777,9 +877,73 @@ func readDecompressedData(buffer *bytes.Buffer, rep *Replay) error {
 
 	}
 
+	resolveCountdownWinner(rep)
+	resolvePlayerResults(rep)
+	resolveAssignedRaces(rep)
+	buildGameFlowTimeline(rep, time.Duration(currentTimeMS)*time.Millisecond)
+	buildAllianceTimelines(rep)
+	collectTriggerChat(rep)
+	decodeMMD(rep)
 	return nil
 }
 
+// readCommandData reads the actions of every player in a time slot's CommandData.
+// Each player's actions are in their own length-prefixed block, so an action id we don't know only
+// loses the rest of that player's block (as an UnknownAction), and the next player's block is read as usual.
+func readCommandData(commandDataBuf *bytes.Buffer, rep *Replay, at time.Duration) error {
+	for commandDataBuf.Len() > 0 {
+		var player *Player
+		if playerId, err := commandDataBuf.ReadByte(); err != nil {
+			return fmt.Errorf("error reading CommandData playerId: %w", err)
+		} else {
+			player = rep.Players[int(playerId)]
+		}
+		actionBlockLen, err := readWORD(commandDataBuf)
+		if err != nil {
+			return fmt.Errorf("error reading action block len: %w", err)
+		}
+		actionBlockBytes := make([]byte, actionBlockLen)
+		if _, err := commandDataBuf.Read(actionBlockBytes); err != nil {
+			return fmt.Errorf("error reading action block: %w", err)
+		}
+		actionBlockBuf := bytes.NewBuffer(actionBlockBytes)
+		for actionBlockBuf.Len() > 0 {
+			actionable, err := readActionBlock(actionBlockBuf, rep)
+			if err != nil {
+				if err == io.EOF {
+					// truncated action, nothing after it in this block can be read anyway
+					break
+				}
+				return fmt.Errorf("error parsing action block: %w", err)
+			}
+			action := Action{
+				Ability: actionable,
+				Time:    at,
+				Player:  player,
+			}
+			if action.Ability != nil {
+				rep.Actions = append(rep.Actions, action)
+			}
+		}
+	}
+	return nil
+}
+
+// readCosmeticsPlayerId finds the player id (field 1) in a Reforged 0x39 sub-record of kind 4 or 5
+func readCosmeticsPlayerId(data []byte) (playerId int, err error) {
+	buffer := bytes.NewBuffer(data)
+	for buffer.Len() > 0 {
+		field, value, _, _, err := readProtobufField(buffer)
+		if err != nil {
+			return 0, err
+		}
+		if field == 1 {
+			return int(value), nil
+		}
+	}
+	return 0, fmt.Errorf("no player id in cosmetics record")
+}
+
 func readBattleNetAcct(bnetBuffer *bytes.Buffer) (account BattleNet2Account, err error) {
 	if err := expectByte(bnetBuffer, 0x0A); err != nil {
 		return account, err
@@ -800,45 +964,40 @@ func readBattleNetAcct(bnetBuffer *bytes.Buffer) (account BattleNet2Account, err
 	return readBnetAcctInner(bnetAccountBuffer)
 }
 func readBnetAcctInner(bnetAccountBuffer *bytes.Buffer) (account BattleNet2Account, err error) {
+	// the account is a protobuf message, where each section starts with a byte saying which field it is
 	for bnetAccountBuffer.Len() > 0 {
-		sectionByte, err := bnetAccountBuffer.ReadByte()
-		if err != nil {
-			return account, fmt.Errorf("error reading account block's section: %w", err)
+		rest := bnetAccountBuffer.Bytes()
+		sectionByte := rest[0]
+		if sectionByte == 0x28 {
+			account.ExtraData = append([]byte(nil), rest[1:]...)
 		}
-		switch sectionByte {
-		case 0x08: // id of playerRecord
-			pRecId, err := bnetAccountBuffer.ReadByte()
-			if err != nil {
-				return account, fmt.Errorf("error reading account's playerRecord id: %w", err)
+		_, value, data, raw, err := readProtobufField(bnetAccountBuffer)
+		if errors.Is(err, errUnsupportedWireType) {
+			// can't tell where this section ends, so keep it and everything after it as it is
+			if account.Unknown == nil {
+				account.Unknown = make(map[byte][]byte)
 			}
-			account.PlayerId = int(pRecId)
-
+			account.Unknown[sectionByte] = append([]byte(nil), rest[1:]...)
 			break
+		} else if err != nil {
+			return account, fmt.Errorf("error reading account block's section 0x%x: %w", sectionByte, err)
+		}
+		switch sectionByte {
+		case 0x08: // id of playerRecord
+			account.PlayerId = int(value)
 		case 0x12: // username
-			bnetUsername, err := readLengthAndThenString(bnetAccountBuffer)
-			if err != nil {
-				return account, fmt.Errorf("error reading username: %w", err)
-			}
-			account.Username = bnetUsername
-			break
+			account.Username = string(data)
 		case 0x22: // avatar
-			avatarName, err := readLengthAndThenString(bnetAccountBuffer)
-			if err != nil {
-				return account, fmt.Errorf("error reading avatar: %w", err)
-			}
-			account.Avatar = avatarName
-			break
+			account.Avatar = string(data)
 		case 0x1A: // this seems to always just be the string "clan"
-			clanName, err := readLengthAndThenString(bnetAccountBuffer)
-			if err != nil {
-				return account, fmt.Errorf("error reading clan: %w", err)
-			}
-			account.Clan = clanName
-		case 0x28: // no idea what this represents
-			account.ExtraData, _ = ioutil.ReadAll(bnetAccountBuffer)
-
+			account.Clan = string(data)
+		case 0x28:
+			account.Region = BnetRegion(value)
 		default:
-			fmt.Printf("[***] Unrecognized byte in block: 0x%x\n", sectionByte)
+			if account.Unknown == nil {
+				account.Unknown = make(map[byte][]byte)
+			}
+			account.Unknown[sectionByte] = append([]byte(nil), raw[1:]...)
 		}
 	}
 	if account.Avatar == "" {
@@ -874,6 +1033,8 @@ func readEncodedString(encodedStr string, rep *Replay) error {
 	if err != nil {
 		return fmt.Errorf("error reading game settings: %w", err)
 	}
+	otherFlags := uint32(byte2&0x80) << 8
+	otherFlags |= uint32(fixedTeamsByte&0xF9) << 16
 	fixedTeamsByte = fixedTeamsByte >> 1
 	lockTeams := (fixedTeamsByte & 0b11) == 3
 	rep.GameOptions.LockTeams = lockTeams
@@ -892,7 +1053,27 @@ func readEncodedString(encodedStr string, rep *Replay) error {
 	if observerReferees {
 		rep.GameOptions.ObserverSetting = ObsReferees
 	}
-	_, _ = decoded.Read(make([]byte, 5+4)) //skip unknown bytes & map checksum (4)
+	otherFlags |= uint32(byte3&0xB8) << 24
+	rep.GameOptions.OtherFlags = otherFlags
+	// ends the flags, and has been 0 in every replay so far
+	if _, err = decoded.ReadByte(); err != nil {
+		return fmt.Errorf("error reading game settings: %w", err)
+	}
+	mapWidth, err := readWORD(decoded)
+	if err != nil {
+		return fmt.Errorf("error reading map width: %w", err)
+	}
+	mapHeight, err := readWORD(decoded)
+	if err != nil {
+		return fmt.Errorf("error reading map height: %w", err)
+	}
+	rep.GameOptions.MapWidth = int(mapWidth)
+	rep.GameOptions.MapHeight = int(mapHeight)
+	mapChecksum, err := readDWORD(decoded)
+	if err != nil {
+		return fmt.Errorf("error reading map checksum: %w", err)
+	}
+	rep.GameOptions.MapChecksum = mapChecksum
 	mapName, err := decoded.ReadString(0)
 	if err != nil {
 		return fmt.Errorf("error reading map name: %w", err)
@@ -912,6 +1093,13 @@ func readEncodedString(encodedStr string, rep *Replay) error {
 	} else if s != "\000" {
 		return fmt.Errorf("third decoded string should have been empty: '%s'", s)
 	}
+
+	// since 1.23, this is followed by the map's SHA-1
+	if rep.Version >= 23 {
+		if _, err = io.ReadFull(decoded, rep.GameOptions.MapSHA1[:]); err != nil {
+			return fmt.Errorf("error reading map SHA-1: %w", err)
+		}
+	}
 	return nil
 }
 func readPlayerRecord(buffer *bytes.Buffer, rep *Replay) (playerRecord playerRecord, err error) {
@@ -938,7 +1126,7 @@ func readPlayerRecord(buffer *bytes.Buffer, rep *Replay) (playerRecord playerRec
 		}
 	} else if additionalDataSize == 0x8 {
 		// For ladder games only
-		// TODO: make use of these
+		playerRecord.hasLadderData = true
 		// runtime of players Warcraf.exe in milliseconds
 		if runtimeMS, err := readDWORD(buffer); err != nil {
 			return playerRecord, fmt.Errorf("error reading player exe runtime: %w", err)
@@ -960,7 +1148,9 @@ func readPlayerRecord(buffer *bytes.Buffer, rep *Replay) (playerRecord playerRec
 			fmt.Printf("Warning: unrecognized additional data size: 0x%x\n", additionalDataSize)
 		}
 		additionalData := make([]byte, additionalDataSize)
-		_, err = buffer.Read(additionalData)
+		if _, err = io.ReadFull(buffer, additionalData); err != nil {
+			return playerRecord, fmt.Errorf("error reading player additional data: %w", err)
+		}
 		if rep.debugMode {
 			fmt.Println("additional data:", additionalData)
 		}
@@ -978,16 +1168,30 @@ type playerRecord struct {
 	RaceFlags uint32
 	Bnet2Acc  *BattleNet2Account
 	SlotId    int
-	leaveTime int
+	// hasLadderData is set if RuntimeMS and RaceFlags were there
+	hasLadderData bool
+}
+
+// ReplayHeader is everything in the header of a .w3g file (the part before the compressed data).
+type ReplayHeader struct {
+	GameVersion int
+	// HeaderVersion is 0 for replays from 1.06 and below, 1 after
+	HeaderVersion    uint32
+	NumberOfBlocks   uint32
+	Length           uint32
+	CompressedSize   uint32
+	DecompressedSize uint32
+	BuildNumber      int
+	Flags            uint16
+	IsMultiplayer    bool
+	Duration         time.Duration
+	Expac            Expac
+	// Checksum is the CRC32 of the header, stored in the header itself
+	Checksum         uint32
+	computedChecksum uint32
 }
 
-type header struct {
-	GameVersion    int
-	HeaderVersion  uint32
-	NumberOfBlocks uint32
-	Length         uint32
-	BuildNumber    int
-	IsMultiplayer  bool
-	Duration       time.Duration
-	Expac          Expac
+// ChecksumValid reports whether the header's bytes match its stored CRC32.
+func (h ReplayHeader) ChecksumValid() bool {
+	return h.Checksum == h.computedChecksum
 }
@@ -1,10 +1,16 @@
 package warcrumb
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestRead(t *testing.T) {
@@ -55,3 +61,288 @@ func TestRead(t *testing.T) {
 		})
 	}
 }
+
+// parseTestReplay parses one of the replays in testReplays, failing the test if it can't be
+func parseTestReplay(t *testing.T, name string, options ...ParseOption) Replay {
+	t.Helper()
+	f, err := os.Open(path.Join("testReplays", name))
+	if err != nil {
+		t.Fatalf("Could not open test replay: %v", err)
+	}
+	defer f.Close()
+	rep, err := ParseReplay(f, options...)
+	if err != nil {
+		t.Fatalf("%s: ParseReplay() error = %v", name, err)
+	}
+	return rep
+}
+
+func TestReadCommandDataUnknownAction(t *testing.T) {
+	rep := &Replay{Version: 10032, Players: map[int]*Player{1: {Id: 1}, 2: {Id: 2}}}
+	commandData := []byte{
+		0x01, 0x04, 0x00, 0xEE, 0x01, 0x02, 0x03, // player 1: an id we don't know about
+		0x02, 0x02, 0x00, 0x75, 0x03, // player 2: arrow key
+	}
+	if err := readCommandData(bytes.NewBuffer(commandData), rep, time.Second); err != nil {
+		t.Fatalf("readCommandData() error = %v", err)
+	}
+	want := []Action{
+		{Ability: UnknownAction{ID: 0xEE, Raw: []byte{0x01, 0x02, 0x03}}, Time: time.Second, Player: rep.Players[1]},
+		{Ability: UnknownAction{ID: 0x75, Raw: []byte{0x03}}, Time: time.Second, Player: rep.Players[2]},
+	}
+	if !reflect.DeepEqual(rep.Actions, want) {
+		t.Errorf("readCommandData() got %v, want %v", rep.Actions, want)
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	filePath := path.Join("testReplays", "W3R-22259-Grubby(O) vs Happy(UD).w3g")
+	f, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("Could not open test replay: %v", err)
+	}
+	defer f.Close()
+	header, err := ReadHeader(f)
+	if err != nil {
+		t.Fatalf("ReadHeader() error = %v", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if int64(header.CompressedSize) != info.Size() {
+		t.Errorf("CompressedSize = %d, want file size %d", header.CompressedSize, info.Size())
+	}
+	if header.HeaderVersion != 1 || header.Expac != TheFrozenThrone || !header.IsMultiplayer || header.Duration == 0 {
+		t.Errorf("unexpected header: %+v", header)
+	}
+
+	rep := parseTestReplay(t, "W3R-22259-Grubby(O) vs Happy(UD).w3g")
+	if rep.Duration != header.Duration || rep.Version != header.GameVersion {
+		t.Errorf("header (%s, %d) doesn't match replay (%s, %d)", header.Duration, header.GameVersion, rep.Duration, rep.Version)
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	files, err := ioutil.ReadDir("testReplays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(path.Join("testReplays", file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rep, err := ParseReplay(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: ParseReplay() error = %v", file.Name(), err)
+		}
+		if !rep.Integrity.OK() {
+			t.Errorf("%s: integrity check failed: %+v", file.Name(), rep.Integrity)
+		}
+	}
+
+	data, err := ioutil.ReadFile(path.Join("testReplays", "2pLan.w3g"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := ReadHeader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hex-edit the duration
+	edited := append([]byte(nil), data...)
+	edited[header.Length-8]++
+	rep, err := ParseReplay(bytes.NewReader(edited))
+	if err != nil {
+		t.Fatalf("ParseReplay() error = %v", err)
+	}
+	if rep.Integrity.HeaderChecksumOK || rep.Integrity.OK() {
+		t.Errorf("edited header passed integrity check: %+v", rep.Integrity)
+	}
+
+	// hex-edit the first block's checksum, which comes after the two sizes
+	checksumOffset := header.Length + 4
+	if header.GameVersion >= 10032 {
+		checksumOffset = header.Length + 8
+	}
+	edited = append([]byte(nil), data...)
+	edited[checksumOffset]++
+	rep, err = ParseReplay(bytes.NewReader(edited))
+	if err != nil {
+		t.Fatalf("ParseReplay() error = %v", err)
+	}
+	if !rep.Integrity.HeaderChecksumOK || rep.Integrity.Blocks[0].OK() || !rep.Integrity.Blocks[1].OK() || rep.Integrity.OK() {
+		t.Errorf("edited block passed integrity check: %+v", rep.Integrity)
+	}
+}
+
+func TestLobbyOnly(t *testing.T) {
+	files, err := ioutil.ReadDir("testReplays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(path.Join("testReplays", file.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		full, err := ParseReplay(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("%s: ParseReplay() error = %v", file.Name(), err)
+		}
+		lobby, err := ParseReplay(bytes.NewReader(data), LobbyOnly())
+		if err != nil {
+			t.Fatalf("%s: ParseReplay(LobbyOnly()) error = %v", file.Name(), err)
+		}
+		if len(lobby.Actions) != 0 || len(lobby.ChatMessages) != 0 {
+			t.Errorf("%s: lobby-only parse read past the lobby", file.Name())
+		}
+		if len(lobby.Integrity.Blocks) >= len(full.Integrity.Blocks) && len(full.Integrity.Blocks) > 1 {
+			t.Errorf("%s: lobby-only parse decompressed all %d blocks", file.Name(), len(lobby.Integrity.Blocks))
+		}
+		if lobby.GameOptions != full.GameOptions || lobby.RandomSeed != full.RandomSeed || len(lobby.Slots) != len(full.Slots) || len(lobby.Players) != len(full.Players) {
+			t.Errorf("%s: lobby doesn't match full parse", file.Name())
+		}
+		for id, p := range full.Players {
+			if lobby.Players[id] == nil || lobby.Players[id].Name != p.Name || lobby.Players[id].SlotId != p.SlotId || lobby.Slots[p.SlotId].Race != full.Slots[p.SlotId].Race {
+				t.Errorf("%s: lobby player %d doesn't match full parse", file.Name(), id)
+			}
+		}
+	}
+}
+
+func TestReadLobbyTruncated(t *testing.T) {
+	_, data := readTestReplayData(t, "FirstWin.w3g")
+	bnet := bytes.Index(data, []byte{0x39, 0x03})
+	if bnet < 0 {
+		t.Fatal("no Battle.net 2.0 block in FirstWin.w3g")
+	}
+	// cut off in the middle of the Battle.net 2.0 block, after its id, kind and length
+	var rep Replay
+	err := readLobby(bytes.NewBuffer(data[:bnet+2+4+10]), &rep)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("readLobby() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestReadCosmetics(t *testing.T) {
+	rep := parseTestReplay(t, "2pLan.w3g", LobbyOnly())
+	if !bytes.Equal(rep.Players[1].Cosmetics.Unknown[4], []byte{0x08, 0x01, 0x08, 0x01}) {
+		t.Errorf("player 1's cosmetics = %+v", rep.Players[1].Cosmetics)
+	}
+	if !bytes.Equal(rep.Players[2].Cosmetics.Unknown[5], []byte{0x08, 0x02, 0x10, 0x00}) {
+		t.Errorf("player 2's cosmetics = %+v", rep.Players[2].Cosmetics)
+	}
+}
+
+func TestBattleNetAccount(t *testing.T) {
+	rep := parseTestReplay(t, "FirstWin.w3g", LobbyOnly())
+	regions := map[string]BnetRegion{}
+	for _, p := range rep.Players {
+		if p.BattleNet == nil {
+			// the "Blizzard" player
+			continue
+		}
+		regions[p.BattleNet.Username] = p.BattleNet.Region
+		if !bytes.Equal(p.BattleNet.Unknown[0x32], []byte{0x00}) {
+			t.Errorf("%s: Unknown = %v, want the empty 0x32 section", p.Name, p.BattleNet.Unknown)
+		}
+	}
+	if regions["comfyblanket#1856"] != RegionAmericas || regions["eSprim#2758"] != RegionEurope {
+		t.Errorf("unexpected regions: %v", regions)
+	}
+}
+
+func TestReadBnetAcctUnsupportedWireType(t *testing.T) {
+	// player 1, "abc", Europe, then a group (wire type 3), which can't be skipped over
+	acct, err := readBnetAcctInner(bytes.NewBuffer([]byte{0x08, 0x01, 0x12, 0x03, 'a', 'b', 'c', 0x28, 0x14, 0x33, 0x01, 0x02}))
+	if err != nil {
+		t.Fatalf("readBnetAcctInner() error = %v", err)
+	}
+	if acct.PlayerId != 1 || acct.Username != "abc" || acct.Region != RegionEurope {
+		t.Errorf("got %+v", acct)
+	}
+	if !reflect.DeepEqual(acct.Unknown, map[byte][]byte{0x33: {0x01, 0x02}}) {
+		t.Errorf("Unknown = %v, want the rest after 0x33", acct.Unknown)
+	}
+}
+
+func TestPassword(t *testing.T) {
+	rep := parseTestReplay(t, "withDKskin.w3g", LobbyOnly())
+	if !rep.GameOptions.HasPassword || rep.GameOptions.Password != "" {
+		t.Errorf("password should be redacted by default, got HasPassword = %v, Password = %q", rep.GameOptions.HasPassword, rep.GameOptions.Password)
+	}
+
+	rep = parseTestReplay(t, "withDKskin.w3g", LobbyOnly(), RevealPassword())
+	if rep.GameOptions.Password != "hunter2" {
+		t.Errorf("Password = %q, want hunter2", rep.GameOptions.Password)
+	}
+
+	// and it's not printed in debug mode either
+	f, err := os.Open(path.Join("testReplays", "withDKskin.w3g"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = w
+	printed := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		printed <- b
+	}()
+	_, err = ParseReplayDebug(f, LobbyOnly())
+	os.Stdout = stdout
+	w.Close()
+	if err != nil {
+		t.Fatalf("ParseReplayDebug() error = %v", err)
+	}
+	if bytes.Contains(<-printed, []byte("hunter2")) {
+		t.Error("ParseReplayDebug printed the password without RevealPassword")
+	}
+}
+
+func TestMapChecksum(t *testing.T) {
+	tests := []struct {
+		filePath string
+		checksum uint32
+		sha1     string
+	}{
+		{"1.01-LeoLaporte_vs_Ghostridah_crazy.w3g", 0x1360f411, "0000000000000000000000000000000000000000"},
+		{"1.18-replayspl_4105_MKpowa_KrawieC..w3g", 0xa763649d, "0000000000000000000000000000000000000000"},
+		{"W3R-118-Archie(HU) & Ezzo(HU) vs Computer (Insane)(RND) & Computer (Insane)(RND).w3g", 0xbd7064c7, "75e948dde708e0e4f195b9ddac545eae6eddde9c"},
+		// the same map hosted in two Reforged builds, with a different checksum
+		{"2pLan.w3g", 0xa1850b9f, "2a62cb932392aeaa4cd36e08785e564898c4ac4a"},
+		{"refTest.w3g", 0xdb24bedf, "2a62cb932392aeaa4cd36e08785e564898c4ac4a"},
+		// matchmaking maps have no checksum, and their SHA-1 in the path
+		{"secondwin.w3g", 0xFFFFFFFF, "38f93342c0803a02b1c7f5c3cc4e18178f09079c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filePath, func(t *testing.T) {
+			options := parseTestReplay(t, tt.filePath, LobbyOnly()).GameOptions
+			if options.MapChecksum != tt.checksum {
+				t.Errorf("MapChecksum = %#x, want %#x", options.MapChecksum, tt.checksum)
+			}
+			if got := fmt.Sprintf("%x", options.MapSHA1); got != tt.sha1 {
+				t.Errorf("MapSHA1 = %s, want %s", got, tt.sha1)
+			}
+			if options.OtherFlags != 0 {
+				t.Errorf("OtherFlags = %#x", options.OtherFlags)
+			}
+		})
+	}
+
+	lan := parseTestReplay(t, "2pLan.w3g", LobbyOnly()).GameOptions
+	if lan.MapWidth != 160 || lan.MapHeight != 72 {
+		t.Errorf("unexpected map size for 2pLan.w3g: %dx%d", lan.MapWidth, lan.MapHeight)
+	}
+	if old := parseTestReplay(t, "1.01-LeoLaporte_vs_Ghostridah_crazy.w3g", LobbyOnly()).GameOptions; old.MapWidth != 124 || old.MapHeight != 124 {
+		t.Errorf("unexpected map size for 1.01: %dx%d", old.MapWidth, old.MapHeight)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"compress/zlib"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"math"
 	"strconv"
@@ -119,7 +121,9 @@ func readPointF(buffer io.Reader) (PointF, error) {
 	return PointF{X, Y}, nil
 }
 
-func readCompressedBlock(file io.Reader, reforged bool) ([]byte, error) {
+// readCompressedBlock reads and inflates one block of replay data, also checking it against the block's checksum
+func readCompressedBlock(file io.Reader, reforged bool) ([]byte, BlockIntegrity, error) {
+	var integrity BlockIntegrity
 	var n uint32
 	var err error
 	if reforged {
@@ -130,7 +134,7 @@ func readCompressedBlock(file io.Reader, reforged bool) ([]byte, error) {
 		err = err2
 	}
 	if err != nil {
-		return nil, fmt.Errorf("error reading size of compressed data block: %w", err)
+		return nil, integrity, fmt.Errorf("error reading size of compressed data block: %w", err)
 	}
 
 	var expectedDecompressedLength uint32
@@ -142,11 +146,11 @@ func readCompressedBlock(file io.Reader, reforged bool) ([]byte, error) {
 		err = err2
 	}
 	if err != nil {
-		return nil, fmt.Errorf("error reading size of decompressed data block: %w", err)
+		return nil, integrity, fmt.Errorf("error reading size of decompressed data block: %w", err)
 	}
-	_, err = readDWORD(file)
+	integrity.StoredChecksum, err = readDWORD(file)
 	if err != nil {
-		return nil, fmt.Errorf("error reading unknown field: %w", err)
+		return nil, integrity, fmt.Errorf("error reading block checksum: %w", err)
 	}
 
 	// padding to 8K bytes seems to have been a LIE
@@ -160,19 +164,40 @@ func readCompressedBlock(file io.Reader, reforged bool) ([]byte, error) {
 	compressedData := make([]byte, int(n))
 	//fmt.Printf("buffer total length: 0x%x\n", len(compressedData))
 	if _, err := file.Read(compressedData); err != nil {
-		return nil, fmt.Errorf("error reading compressed data: %w", err)
+		return nil, integrity, fmt.Errorf("error reading compressed data: %w", err)
 	}
+	integrity.ComputedChecksum = blockChecksum(n, expectedDecompressedLength, reforged, compressedData)
 	zr, err := zlib.NewReader(bytes.NewReader(compressedData))
 	if err != nil {
-		return nil, fmt.Errorf("error decompressing: %w", err)
+		return nil, integrity, fmt.Errorf("error decompressing: %w", err)
 	}
 	inflateBuffer := make([]byte, expectedDecompressedLength)
 	actuallyInflatedBytes, err := zr.Read(inflateBuffer)
 	err = zr.Close()
 	if actuallyInflatedBytes != int(expectedDecompressedLength) {
-		return inflateBuffer, fmt.Errorf("actuallyInflatedBytes (%d) != expectedDecompressedLength (%d)", actuallyInflatedBytes, expectedDecompressedLength)
+		return inflateBuffer, integrity, fmt.Errorf("actuallyInflatedBytes (%d) != expectedDecompressedLength (%d)", actuallyInflatedBytes, expectedDecompressedLength)
 	}
-	return inflateBuffer, err
+	return inflateBuffer, integrity, err
+}
+
+// blockChecksum computes what a block's checksum should be:
+// the low WORD is from the CRC32 of the block header (with the checksum zeroed), the high WORD from the CRC32 of the compressed data,
+// each folded into 16 bits by XORing the halves.
+func blockChecksum(compressedLength, decompressedLength uint32, reforged bool, compressedData []byte) uint32 {
+	var blockHeader []byte
+	if reforged {
+		blockHeader = make([]byte, 12)
+		binary.LittleEndian.PutUint32(blockHeader[0:], compressedLength)
+		binary.LittleEndian.PutUint32(blockHeader[4:], decompressedLength)
+	} else {
+		blockHeader = make([]byte, 8)
+		binary.LittleEndian.PutUint16(blockHeader[0:], uint16(compressedLength))
+		binary.LittleEndian.PutUint16(blockHeader[2:], uint16(decompressedLength))
+	}
+	fold := func(crc uint32) uint32 {
+		return (crc ^ crc>>16) & 0xFFFF
+	}
+	return fold(crc32.ChecksumIEEE(blockHeader)) | fold(crc32.ChecksumIEEE(compressedData))<<16
 }
 
 func decodeString(encoded string) []byte {
@@ -206,16 +231,44 @@ func readLittleEndianString(file io.Reader, nBytes int) (string, error) {
 	return string(buf), nil
 }
 
-// readLengthAndThenString reads a non-null terminated string represented by its length and then the bytes
-func readLengthAndThenString(buffer *bytes.Buffer) (string, error) {
-	stringLength, err := buffer.ReadByte()
+// errUnsupportedWireType is returned by readProtobufField for groups (deprecated in protobuf) and invalid wire types,
+// which it can't work out the length of. Nothing after the key can be read then.
+var errUnsupportedWireType = errors.New("unsupported protobuf wire type")
+
+// readProtobufField reads one field of a protobuf message, which Reforged uses in its lobby data.
+// Varints (and fixed-size numbers) are returned in value, length-delimited fields in data.
+// raw is the whole field including its key, to keep fields we don't understand around.
+func readProtobufField(buffer *bytes.Buffer) (fieldNumber int, value uint64, data []byte, raw []byte, err error) {
+	start := buffer.Bytes()
+	key, err := binary.ReadUvarint(buffer)
 	if err != nil {
-		return "", fmt.Errorf("error reading string length: %w", err)
+		return 0, 0, nil, nil, fmt.Errorf("error reading field key: %w", err)
+	}
+	fieldNumber = int(key >> 3)
+	switch wireType := key & 0x7; wireType {
+	case 0:
+		value, err = binary.ReadUvarint(buffer)
+	case 1:
+		var fixed [8]byte
+		_, err = io.ReadFull(buffer, fixed[:])
+		value = binary.LittleEndian.Uint64(fixed[:])
+	case 2:
+		var length uint64
+		if length, err = binary.ReadUvarint(buffer); err == nil {
+			if length > uint64(buffer.Len()) {
+				return 0, 0, nil, nil, fmt.Errorf("field %d is longer (%d) than what's left (%d)", fieldNumber, length, buffer.Len())
+			}
+			data = buffer.Next(int(length))
+		}
+	case 5:
+		var fixed [4]byte
+		_, err = io.ReadFull(buffer, fixed[:])
+		value = uint64(binary.LittleEndian.Uint32(fixed[:]))
+	default:
+		return 0, 0, nil, nil, fmt.Errorf("%w %d for field %d", errUnsupportedWireType, wireType, fieldNumber)
 	}
-	stringBytes := make([]byte, stringLength)
-	_, err = buffer.Read(stringBytes)
 	if err != nil {
-		return "", fmt.Errorf("error reading string: %w", err)
+		return 0, 0, nil, nil, fmt.Errorf("error reading field %d: %w", fieldNumber, err)
 	}
-	return string(stringBytes), nil
+	return fieldNumber, value, data, start[:len(start)-buffer.Len()], nil
 }
@@ -36,16 +36,29 @@ type Replay struct {
 	Players        map[int]*Player
 	Slots          []Slot
 	RandomSeed     uint32
-	selectMode     byte
-	startSpotCount int
-	ChatMessages   []ChatMessage
+	privateFlag    byte
+	SelectMode     SelectMode
+	StartSpotCount int
+	ChatMessages   []ChatMessage // most of these are in TriggerChat too, see TriggerChatEvent
+	Pauses         []PauseEvent
+	SpeedChanges   []SpeedChange
+	SaveGames      []SaveGameEvent
+	Alliances      []AllianceTimeline
+	TriggerChat    []TriggerChatEvent
+	MMD            *MMD // nil unless the map reports W3MMD stats
 	Saver          *Player
 	WinnerTeam     int // -1 represents a draw
+	Leaves         []LeaveEvent
+	EndCountdown   *EndCountdown // nil unless the map was revealed to force the game to end
+	Checksums      []ChecksumSample
+	Integrity      IntegrityReport
 	Actions        []Action
 }
 
 type parseOptions struct {
-	debugMode bool
+	debugMode      bool
+	lobbyOnly      bool
+	revealPassword bool
 }
 
 type GameOptions struct {
@@ -60,18 +73,93 @@ type GameOptions struct {
 	Visibility            Visibility
 	ObserverSetting       ObserverSetting
 	GameName              string
+	HasPassword           bool
+	// Password is left empty unless the replay was parsed with RevealPassword
+	Password string
+	// MapChecksum is the checksum the game uses to check players have the same map (0xFFFFFFFF in Reforged matchmaking).
+	// It can differ between game versions for the same map file.
+	MapChecksum uint32
+	// MapSHA1 is the hash of the map file, all zeroes before 1.23, which didn't send it
+	MapSHA1 [20]byte
+	// MapWidth and MapHeight are the size of the map's playable area
+	MapWidth  int
+	MapHeight int
+	// OtherFlags are the bits of the game settings flags that aren't decoded into the options above,
+	// at the same place as in the little endian DWORD they're sent as. They've been 0 in every replay so far.
+	OtherFlags uint32
 }
 
 type ObserverSetting int
 
 type GameSpeed int
 
+func (s GameSpeed) String() string {
+	switch s {
+	case SlowSpeed:
+		return "Slow"
+	case NormalSpeed:
+		return "Normal"
+	case FastSpeed:
+		return "Fast"
+	}
+	return "n/a"
+}
+func (s GameSpeed) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 type Expac int
 
 type Visibility int
 
 type GameType uint16
 
+// SelectMode is what players could change about their slot in the lobby.
+type SelectMode byte
+
+func (s SelectMode) String() string {
+	switch s {
+	case TeamsAndRacesSelectable:
+		return "Teams & races selectable"
+	case FixedAlliances:
+		return "Fixed alliances"
+	case FixedPlayerProperties:
+		return "Fixed player properties"
+	case RandomRacesFixed:
+		return "Random races"
+	case AutomatedMatchMaking:
+		return "Automated match making"
+	}
+	return fmt.Sprintf("n/a (%#02x)", byte(s))
+}
+func (s SelectMode) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// GameSource is where a game was played, see Replay.Source.
+type GameSource int
+
+func (s GameSource) String() string {
+	switch s {
+	case SourceLAN:
+		return "LAN"
+	case SourceClassicCustom:
+		return "Classic Battle.net custom game"
+	case SourceClassicLadder:
+		return "Classic Battle.net ladder"
+	case SourceReforgedCustom:
+		return "Reforged custom game"
+	case SourceReforgedMatchmaking:
+		return "Reforged matchmaking"
+	case SourceSingleplayer:
+		return "Singleplayer"
+	}
+	return "Unknown"
+}
+func (s GameSource) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
 type Player struct {
 	Name   string
 	Id     int
@@ -80,6 +168,19 @@ type Player struct {
 	// but that's probably not the best reason
 	slot      *Slot
 	BattleNet *BattleNet2Account
+	Cosmetics Cosmetics // Reforged only
+	Result    PlayerResult
+	LeftAt    time.Duration
+	// ClientRuntime is how long the player's game had been running when the game started (ladder games only)
+	ClientRuntime time.Duration
+	// RaceFlags is the raw race of the player record (ladder games only), which QueuedRace is decoded from
+	RaceFlags uint32
+	// QueuedRace is the race the player picked for ladder matchmaking, UnknownRace in other games
+	QueuedRace Race
+	// AssignedRace is the race the player actually played. For Random that isn't in the replay,
+	// so it's a guess from the item codes of the units, buildings and upgrades they ordered or selected the most.
+	// It stays RandomRace if there were none of those, and always with LobbyOnly, as no actions are read then.
+	AssignedRace Race
 }
 
 func (p Player) String() string {
@@ -90,20 +191,210 @@ func (p Player) String() string {
 	}
 }
 
+// IntegrityReport says whether the replay file matches its own checksums, which it won't if it was edited by hand.
+type IntegrityReport struct {
+	HeaderChecksumOK bool
+	// Blocks only has the blocks that were decompressed, which with LobbyOnly is just the first few
+	Blocks []BlockIntegrity
+	// DecompressedSize is the size of all blocks after inflating, which includes padding at the end of the last block.
+	// It's left at 0 with LobbyOnly, as not all blocks are read.
+	DecompressedSize         int
+	ExpectedDecompressedSize int
+}
+
+// BlockIntegrity is the checksum check for one compressed block.
+type BlockIntegrity struct {
+	StoredChecksum   uint32
+	ComputedChecksum uint32
+}
+
+func (b BlockIntegrity) OK() bool {
+	return b.StoredChecksum == b.ComputedChecksum
+}
+
+// DecompressedSizeOK reports whether the data inflated to the size the header says,
+// give or take the padding of the last 8K block.
+func (i IntegrityReport) DecompressedSizeOK() bool {
+	return i.DecompressedSize >= i.ExpectedDecompressedSize && i.DecompressedSize-i.ExpectedDecompressedSize < 0x2000
+}
+
+// OK reports whether every check passed.
+func (i IntegrityReport) OK() bool {
+	if !i.HeaderChecksumOK || !i.DecompressedSizeOK() {
+		return false
+	}
+	for _, block := range i.Blocks {
+		if !block.OK() {
+			return false
+		}
+	}
+	return true
+}
+
+// ChecksumSample is a checksum of the game state that the game records periodically.
+// Every client computes it independently, so replays of the same game from different players should have the same ones.
+type ChecksumSample struct {
+	Time  time.Duration
+	Value uint32
+}
+
+// EndCountdown is the countdown that starts when a side has lost all their buildings and is revealed to everyone.
+// If it runs out, the game is forced to end.
+type EndCountdown struct {
+	Mode      CountdownMode
+	Seconds   int
+	StartedAt time.Duration
+	// EndedAt is when the countdown ran out, if it did
+	EndedAt time.Duration
+}
+
+type CountdownMode uint32
+
+func (c CountdownMode) String() string {
+	switch c {
+	case CountdownRunning:
+		return "Running"
+	case CountdownOver:
+		return "Over"
+	}
+	return fmt.Sprintf("n/a (%#02x)", uint32(c))
+}
+func (c CountdownMode) MarshalText() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// EndedByCountdown reports whether the game was forced to end by the reveal countdown running out, as opposed to by elimination or leaving.
+func (r Replay) EndedByCountdown() bool {
+	return r.EndCountdown != nil && r.EndCountdown.Mode == CountdownOver
+}
+
+// LeaveEvent is a LeaveGame record, written whenever a player leaves the game (incl. the player who saved the replay, at the very end).
+type LeaveEvent struct {
+	Player *Player
+	Time   time.Duration
+	Reason LeaveReason
+	Result LeaveResult
+}
+
+type LeaveReason uint32
+
+func (l LeaveReason) String() string {
+	switch l {
+	case LeaveRemote:
+		return "Connection closed by remote game"
+	case LeaveLocal:
+		return "Connection closed by local game"
+	case LeaveRemoteUnknown:
+		return "Connection closed (unknown)"
+	}
+	return fmt.Sprintf("n/a (%#02x)", uint32(l))
+}
+func (l LeaveReason) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+type LeaveResult uint32
+
+func (l LeaveResult) String() string {
+	switch l {
+	case LeaveDisconnected:
+		return "Disconnected"
+	case LeaveLeft:
+		return "Left"
+	case LeaveLost:
+		return "Lost"
+	case LeaveWon:
+		return "Won"
+	case LeaveDraw:
+		return "Draw"
+	case LeaveLeftObserver:
+		return "Left (observer)"
+	}
+	return fmt.Sprintf("n/a (%#02x)", uint32(l))
+}
+func (l LeaveResult) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// PlayerResult is how the game ended for a player, as far as we can tell.
+type PlayerResult int
+
+func (p PlayerResult) String() string {
+	switch p {
+	case ResultWon:
+		return "Won"
+	case ResultLost:
+		return "Lost"
+	case ResultDraw:
+		return "Draw"
+	case ResultLeft:
+		return "Left"
+	case ResultDisconnected:
+		return "Disconnected"
+	}
+	return "Unknown"
+}
+func (p PlayerResult) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// Cosmetics are what a Reforged player had equipped from their collection, e.g. hero skins.
+// The format isn't decoded yet, so only the raw records are available.
+type Cosmetics struct {
+	// Unknown has the raw protobuf records by 0x39 sub-record kind (4 for skins, 5 for other cosmetics),
+	// appended in the order they appear
+	Unknown map[byte][]byte
+}
+
 type BattleNet2Account struct {
-	PlayerId  int
-	Avatar    string
-	Username  string
-	Clan      string
+	PlayerId int
+	Avatar   string
+	Username string
+	Clan     string
+	// Region is the Battle.net region the player was connected to for this game, 0 for LAN.
+	// It's not part of who the account is: comfyblanket#1856 is on Americas in FirstWin.w3g and Europe in lotr.w3g.
+	Region BnetRegion
+	// Unknown has the sections that aren't decoded (like 0x32, which has always been an empty string so far),
+	// by section byte, with the raw bytes that follow it (for strings, the length and then the string).
+	// A section that can't be read as a protobuf field has the rest of the account in it.
+	Unknown map[byte][]byte
+	// Deprecated: ExtraData is the raw bytes after the 0x28 section byte, which are decoded into Region and Unknown now.
 	ExtraData []byte
 }
 
+// BnetRegion is the Battle.net region/gateway a Reforged player was on.
+type BnetRegion uint32
+
+func (r BnetRegion) String() string {
+	switch r {
+	case RegionAmericas:
+		return "Americas"
+	case RegionEurope:
+		return "Europe"
+	}
+	return fmt.Sprintf("n/a (%d)", uint32(r))
+}
+func (r BnetRegion) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
 type ChatMessage struct {
 	Timestamp   time.Duration
 	Author      Slot
 	Body        string
 	Destination MsgDestination
 }
+
+// TriggerChatEvent is chat text as seen by map triggers (e.g. mode commands like "-ar").
+// It's a second copy, not separate chat: ordinary messages like "gg" are sent to the triggers as well,
+// and show up in ChatMessages too, unless they were hidden from other players (like "-km 50" in reforgedPudgeWars.w3g).
+// Count chat from ChatMessages only.
+type TriggerChatEvent struct {
+	Timestamp time.Duration
+	Player    *Player
+	Text      string
+}
+
 type MsgDestination interface {
 	isMsgDest() // dummy method to emulate sum type
 	fmt.Stringer
@@ -128,6 +419,31 @@ type MsgToPlayer struct{ Target Slot }
 func (MsgToPlayer) isMsgDest()       {}
 func (m MsgToPlayer) String() string { return "To " + m.Target.String() }
 
+// PauseEvent is a span of time during which the game was paused.
+// If the game was never resumed, End is when the replay ends.
+type PauseEvent struct {
+	Player    *Player
+	Start     time.Duration
+	End       time.Duration
+	ResumedBy *Player
+}
+
+// SpeedChange is a change of game speed during the game, Speed being the speed after the change.
+type SpeedChange struct {
+	Player *Player
+	Time   time.Duration
+	Speed  GameSpeed
+}
+
+// SaveGameEvent is a player saving the game (to a .w3z file) mid-match.
+// Finished is when the save completed, or 0 if that wasn't recorded.
+type SaveGameEvent struct {
+	Player   *Player
+	Time     time.Duration
+	Filename string
+	Finished time.Duration
+}
+
 type Slot struct {
 	Id                    int
 	Player                *Player
@@ -136,6 +452,7 @@ type Slot struct {
 	raceSelectableOrFixed bool
 	SlotStatus            slotStatus
 	TeamNumber            int
+	IsObserver            bool // observers and referees are all on the last team
 	Color                 Color
 	AIStrength            AIStrength
 	Handicap              int
@@ -168,7 +485,12 @@ type Race struct {
 func (r Race) String() string {
 	return r.name
 }
+
+// ShortName is the first letter of the race's name, or "?" if it isn't known (Undead already has "U")
 func (r Race) ShortName() string {
+	if r.name == "" || r == UnknownRace {
+		return "?"
+	}
 	return string(r.name[0])
 }
 func (r Race) MarshalText() ([]byte, error) {
@@ -177,6 +499,17 @@ func (r Race) MarshalText() ([]byte, error) {
 
 type slotStatus string
 
+// Team is everyone playing on one team, as numbered by Slot.TeamNumber, see Replay.Teams.
+type Team struct {
+	Number int
+	// Slots includes computers, which have no Player
+	Slots   []Slot
+	Players []*Player
+	// Races are the races of Slots, using Player.AssignedRace for players
+	Races  []Race
+	Result PlayerResult
+}
+
 type Color struct {
 	color.Color
 	name string
@@ -0,0 +1,97 @@
+package warcrumb
+
+import "time"
+
+// ResourceTransfer is a single transfer of resources, along with how much the sender had sent the receiver in total so far.
+type ResourceTransfer struct {
+	Time        time.Duration
+	FromSlot    int
+	ToSlot      int
+	Gold        int
+	Lumber      int
+	TotalGold   int
+	TotalLumber int
+}
+
+// ResourcePairTotal is how much one slot sent another over the whole game.
+type ResourcePairTotal struct {
+	FromSlot  int
+	ToSlot    int
+	Gold      int
+	Lumber    int
+	Transfers int
+}
+
+type ResourceLedger struct {
+	// Transfers are in chronological order
+	Transfers []ResourceTransfer
+	// Pairs are in order of first transfer
+	Pairs []ResourcePairTotal
+}
+
+// ResourceTransfers collects all the gold and lumber sent between players.
+func (r Replay) ResourceTransfers() ResourceLedger {
+	var ledger ResourceLedger
+	for _, action := range r.Actions {
+		transfer, ok := action.Ability.(TransferResources)
+		if !ok || action.Player == nil {
+			continue
+		}
+		fromSlot := action.Player.SlotId
+		i := 0
+		for ; i < len(ledger.Pairs); i++ {
+			if ledger.Pairs[i].FromSlot == fromSlot && ledger.Pairs[i].ToSlot == transfer.TargetSlot {
+				break
+			}
+		}
+		if i == len(ledger.Pairs) {
+			ledger.Pairs = append(ledger.Pairs, ResourcePairTotal{FromSlot: fromSlot, ToSlot: transfer.TargetSlot})
+		}
+		pair := &ledger.Pairs[i]
+		pair.Gold += transfer.Gold
+		pair.Lumber += transfer.Lumber
+		pair.Transfers++
+		ledger.Transfers = append(ledger.Transfers, ResourceTransfer{
+			Time:        action.Time,
+			FromSlot:    fromSlot,
+			ToSlot:      transfer.TargetSlot,
+			Gold:        transfer.Gold,
+			Lumber:      transfer.Lumber,
+			TotalGold:   pair.Gold,
+			TotalLumber: pair.Lumber,
+		})
+	}
+	return ledger
+}
+
+// Sent returns the total gold and lumber the player gave to others.
+func (l ResourceLedger) Sent(player *Player) (gold, lumber int) {
+	for _, pair := range l.Pairs {
+		if pair.FromSlot == player.SlotId {
+			gold += pair.Gold
+			lumber += pair.Lumber
+		}
+	}
+	return gold, lumber
+}
+
+// Received returns the total gold and lumber the player got from others.
+func (l ResourceLedger) Received(player *Player) (gold, lumber int) {
+	for _, pair := range l.Pairs {
+		if pair.ToSlot == player.SlotId {
+			gold += pair.Gold
+			lumber += pair.Lumber
+		}
+	}
+	return gold, lumber
+}
+
+// Between returns the total gold and lumber sent from one player to another (not the other way around).
+func (l ResourceLedger) Between(from, to *Player) (gold, lumber int) {
+	for _, pair := range l.Pairs {
+		if pair.FromSlot == from.SlotId && pair.ToSlot == to.SlotId {
+			return pair.Gold, pair.Lumber
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,18 @@
+package warcrumb
+
+import "testing"
+
+func TestResourceTransfers(t *testing.T) {
+	rep := parseTestReplay(t, "FirstWin.w3g")
+	ledger := rep.ResourceTransfers()
+	if len(ledger.Transfers) != 2 {
+		t.Fatalf("expected 2 transfers, got %+v", ledger.Transfers)
+	}
+	from, to := rep.Slots[0].Player, rep.Slots[1].Player
+	if gold, lumber := ledger.Between(from, to); gold != 400 || lumber != 100 {
+		t.Errorf("Between() = %d gold, %d lumber, want 400, 100", gold, lumber)
+	}
+	if gold, lumber := ledger.Received(from); gold != 0 || lumber != 0 {
+		t.Errorf("Received() = %d gold, %d lumber, want 0, 0", gold, lumber)
+	}
+}
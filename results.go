@@ -0,0 +1,71 @@
+package warcrumb
+
+// resolveCountdownWinner decides WinnerTeam from the reveal countdown if the leave records didn't.
+// When the countdown runs out, the revealed side gets forced out,
+// so if only one team still has players in the game after that, they're the winners.
+func resolveCountdownWinner(rep *Replay) {
+	if rep.WinnerTeam != 0 || !rep.EndedByCountdown() {
+		return
+	}
+	winner := 0
+	for _, player := range rep.Players {
+		team := player.slot.TeamNumber
+		if player.slot.IsObserver || (player.LeftAt != 0 && player.LeftAt <= rep.EndCountdown.EndedAt) {
+			continue
+		}
+		if winner != 0 && winner != team {
+			return // more than one team left standing
+		}
+		winner = team
+	}
+	rep.WinnerTeam = winner
+}
+
+// resolvePlayerResults works out each Player.Result from their LeaveGame record, falling back on WinnerTeam
+func resolvePlayerResults(rep *Replay) {
+	for _, leave := range rep.Leaves {
+		if leave.Player != nil {
+			leave.Player.Result = leaveToPlayerResult(leave)
+		}
+	}
+	for _, player := range rep.Players {
+		if player.Result != ResultUnknown || player.slot.IsObserver {
+			continue
+		}
+		switch {
+		case rep.WinnerTeam == -1:
+			player.Result = ResultDraw
+		case rep.WinnerTeam > 0 && player.slot.TeamNumber == rep.WinnerTeam:
+			player.Result = ResultWon
+		case rep.WinnerTeam > 0:
+			player.Result = ResultLost
+		}
+	}
+}
+
+func leaveToPlayerResult(leave LeaveEvent) PlayerResult {
+	if leave.Reason == LeaveLocal {
+		// the local game closes the connection to everyone still there when the saver leaves,
+		// and then the result is from the saver's point of view, so it only tells us about disconnects and draws
+		switch leave.Result {
+		case LeaveDisconnected:
+			return ResultDisconnected
+		case LeaveDraw:
+			return ResultDraw
+		}
+		return ResultUnknown
+	}
+	switch leave.Result {
+	case LeaveDisconnected:
+		return ResultDisconnected
+	case LeaveLeft, LeaveLeftObserver:
+		return ResultLeft
+	case LeaveLost:
+		return ResultLost
+	case LeaveWon:
+		return ResultWon
+	case LeaveDraw:
+		return ResultDraw
+	}
+	return ResultUnknown
+}
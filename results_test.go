@@ -0,0 +1,110 @@
+package warcrumb
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestResolveCountdownWinner(t *testing.T) {
+	rep := Replay{
+		Version:      10032,
+		Slots:        []Slot{{Id: 0, TeamNumber: 1}, {Id: 1, TeamNumber: 2}, {Id: 2, TeamNumber: 25, IsObserver: true}},
+		EndCountdown: &EndCountdown{Mode: CountdownOver, Seconds: 120, StartedAt: time.Minute, EndedAt: 3 * time.Minute},
+	}
+	revealed := &Player{Id: 1, SlotId: 0, slot: &rep.Slots[0], LeftAt: 3 * time.Minute}
+	winner := &Player{Id: 2, SlotId: 1, slot: &rep.Slots[1], LeftAt: 3*time.Minute + 5*time.Second}
+	observer := &Player{Id: 3, SlotId: 2, slot: &rep.Slots[2], LeftAt: 4 * time.Minute}
+	rep.Players = map[int]*Player{1: revealed, 2: winner, 3: observer}
+
+	resolveCountdownWinner(&rep)
+	if rep.WinnerTeam != 2 {
+		t.Fatalf("WinnerTeam = %d, want 2", rep.WinnerTeam)
+	}
+	resolvePlayerResults(&rep)
+	if revealed.Result != ResultLost || winner.Result != ResultWon || observer.Result != ResultUnknown {
+		t.Errorf("unexpected results: revealed %s, winner %s, observer %s", revealed.Result, winner.Result, observer.Result)
+	}
+}
+
+// None of testReplays ends by countdown, so this splices a countdown into a real 1v1 replay
+// right after the loser's leave record, which is where it would have run out.
+func TestCountdownWinnerSpliced(t *testing.T) {
+	header, data := readTestReplayData(t, "W3R-28524-Lyn(O) vs LawLiet(NE).w3g")
+	// LeaveGame: remote, player 2 (像昨天一样), result 0x0D
+	loserLeave := []byte{0x17, 0x01, 0x00, 0x00, 0x00, 0x02, 0x0D, 0x00, 0x00, 0x00}
+	i := bytes.Index(data, loserLeave)
+	if i < 0 || bytes.Index(data[i+1:], loserLeave) >= 0 {
+		t.Fatalf("found the loser's leave record at %d, want exactly one", i)
+	}
+	i += len(loserLeave) + 4 // and its unknown DWORD
+	countdown := []byte{
+		0x2F, 0x00, 0x00, 0x00, 0x00, 0x78, 0x00, 0x00, 0x00, // running, 120s
+		0x2F, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // over
+	}
+	data = append(data[:i:i], append(countdown, data[i:]...)...)
+
+	rep := Replay{Version: header.GameVersion}
+	if err := readDecompressedData(bytes.NewBuffer(data), &rep); err != nil {
+		t.Fatalf("readDecompressedData() error = %v", err)
+	}
+	if !rep.EndedByCountdown() || rep.EndCountdown.Seconds != 120 || rep.EndCountdown.EndedAt != 42*time.Minute+14*time.Second+532*time.Millisecond {
+		t.Fatalf("EndCountdown = %+v", rep.EndCountdown)
+	}
+	if rep.WinnerTeam != 1 {
+		t.Fatalf("WinnerTeam = %d, want 1", rep.WinnerTeam)
+	}
+	want := map[string]PlayerResult{"咪咕猫": ResultWon, "像昨天一样": ResultLost}
+	for _, player := range rep.Players {
+		if res, ok := want[player.String()]; ok && player.Result != res {
+			t.Errorf("%s.Result = %s, want %s", player, player.Result, res)
+		}
+	}
+}
+
+// readTestReplayData decompresses one of the replays in testReplays without parsing it
+func readTestReplayData(t *testing.T, name string) (ReplayHeader, []byte) {
+	t.Helper()
+	f, err := os.Open(path.Join("testReplays", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	header, err := readHeader(f)
+	if err != nil {
+		t.Fatalf("%s: readHeader() error = %v", name, err)
+	}
+	var data []byte
+	for i := 0; i < int(header.NumberOfBlocks); i++ {
+		b, _, err := readCompressedBlock(f, header.GameVersion >= 10032)
+		if err != nil {
+			t.Fatalf("%s: block %d: %v", name, i, err)
+		}
+		data = append(data, b...)
+	}
+	return header, data
+}
+
+func TestPlayerResults(t *testing.T) {
+	rep := parseTestReplay(t, "FirstWin.w3g")
+	if len(rep.Leaves) != len(rep.Players) {
+		t.Errorf("got %d leaves for %d players", len(rep.Leaves), len(rep.Players))
+	}
+	want := map[string]PlayerResult{
+		"eSprim#2758":       ResultLost,
+		"Askari26666#2997":  ResultLost,
+		"Midnight#2198":     ResultWon,
+		"comfyblanket#1856": ResultWon,
+		"Blizzard":          ResultUnknown, // observer
+	}
+	for _, player := range rep.Players {
+		if got := player.Result; got != want[player.String()] {
+			t.Errorf("%s.Result = %s, want %s", player, got, want[player.String()])
+		}
+		if player.LeftAt == 0 {
+			t.Errorf("%s.LeftAt not set", player)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package warcrumb
+
+import "time"
+
+// SelectionAt replays the player's selection changes to work out what they had selected at time t,
+// e.g. to see which units an ability was issued to.
+// Actions at exactly t are included, so passing the time of an ability gives the selection it was issued with.
+func (r Replay) SelectionAt(player *Player, t time.Duration) []ObjectHandle {
+	var selection []ObjectHandle
+	for _, action := range r.Actions {
+		if action.Time > t {
+			break
+		}
+		if action.Player != player {
+			continue
+		}
+		switch ability := action.Ability.(type) {
+		case ChangeSelection:
+			selection = applySelectionChange(selection, ability)
+		case SelectGroupHotkey:
+			selection = append([]ObjectHandle(nil), ability.Objects...)
+		}
+	}
+	return selection
+}
+
+func applySelectionChange(selection []ObjectHandle, change ChangeSelection) []ObjectHandle {
+	switch change.Mode {
+	case SelectionAdd:
+		for _, object := range change.Objects {
+			if !containsObject(selection, object) {
+				selection = append(selection, object)
+			}
+		}
+	case SelectionRemove:
+		kept := selection[:0]
+		for _, object := range selection {
+			if !containsObject(change.Objects, object) {
+				kept = append(kept, object)
+			}
+		}
+		selection = kept
+	}
+	return selection
+}
+
+func containsObject(objects []ObjectHandle, object ObjectHandle) bool {
+	for _, o := range objects {
+		if o == object {
+			return true
+		}
+	}
+	return false
+}
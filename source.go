@@ -0,0 +1,36 @@
+package warcrumb
+
+// Source works out where the game was played from the game type, the private flag and the select mode.
+//
+// Classic ladder games are recognized by their ladder player records (see Player.RaceFlags), or by the select mode or
+// game type for AMM. Classic LAN games look the same as Battle.net custom games, so both are SourceUnknown.
+// In Reforged, a game where nobody has a Battle.net region is taken to be LAN.
+func (r Replay) Source() GameSource {
+	if r.GameType == Singleplayer || !r.IsMultiplayer {
+		return SourceSingleplayer
+	}
+	if !r.isReforged {
+		if r.SelectMode == AutomatedMatchMaking || r.GameType == LadderTeam {
+			return SourceClassicLadder
+		}
+		for _, player := range r.Players {
+			if player.RaceFlags != 0 || player.ClientRuntime != 0 {
+				return SourceClassicLadder
+			}
+		}
+		return SourceUnknown
+	}
+	switch {
+	case r.SelectMode == AutomatedMatchMaking || r.privateFlag&0xC0 == 0x40:
+		return SourceReforgedMatchmaking
+	case r.privateFlag&0x20 != 0:
+		// public custom game
+		return SourceReforgedCustom
+	}
+	for _, player := range r.Players {
+		if player.BattleNet != nil && player.BattleNet.Region != 0 {
+			return SourceReforgedCustom
+		}
+	}
+	return SourceLAN
+}
@@ -0,0 +1,36 @@
+package warcrumb
+
+import "testing"
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		filePath string
+		want     GameSource
+	}{
+		{"1.01-LeoLaporte_vs_Ghostridah_crazy.w3g", SourceUnknown},
+		{"1.18-replayspl_4105_MKpowa_KrawieC..w3g", SourceClassicLadder},
+		{"W3R-28524-Lyn(O) vs LawLiet(NE).w3g", SourceUnknown},
+		{"2pLan.w3g", SourceLAN},
+		{"refOffline.w3g", SourceLAN},
+		{"FirstWin.w3g", SourceReforgedMatchmaking},
+		{"lotr.w3g", SourceReforgedCustom},
+		{"withDKskin.w3g", SourceReforgedCustom},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filePath, func(t *testing.T) {
+			rep := parseTestReplay(t, tt.filePath, LobbyOnly())
+			if got := rep.Source(); got != tt.want {
+				t.Errorf("Source() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSourceClassicLadderRecords(t *testing.T) {
+	// pre-AMM ladder 1on1 and FFA games have no 0xCC select mode, only the ladder player records
+	rep := parseTestReplay(t, "1.18-replayspl_4105_MKpowa_KrawieC..w3g", LobbyOnly())
+	rep.SelectMode = TeamsAndRacesSelectable
+	if got := rep.Source(); got != SourceClassicLadder {
+		t.Errorf("Source() = %s, want %s", got, SourceClassicLadder)
+	}
+}
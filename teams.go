@@ -0,0 +1,65 @@
+package warcrumb
+
+import "sort"
+
+// Teams groups the occupied slots by team, in order of team number, leaving out observers and referees.
+func (r Replay) Teams() []Team {
+	byNumber := make(map[int]*Team)
+	var numbers []int
+	for _, slot := range r.Slots {
+		if slot.SlotStatus != UsedSlot || slot.IsObserver {
+			continue
+		}
+		team, ok := byNumber[slot.TeamNumber]
+		if !ok {
+			team = &Team{Number: slot.TeamNumber}
+			byNumber[slot.TeamNumber] = team
+			numbers = append(numbers, slot.TeamNumber)
+		}
+		team.Slots = append(team.Slots, slot)
+		if slot.Player != nil {
+			team.Players = append(team.Players, slot.Player)
+			team.Races = append(team.Races, slot.Player.AssignedRace)
+		} else {
+			team.Races = append(team.Races, slot.Race)
+		}
+	}
+	sort.Ints(numbers)
+
+	teams := make([]Team, 0, len(numbers))
+	for _, number := range numbers {
+		team := byNumber[number]
+		team.Result = r.teamResult(*team)
+		teams = append(teams, *team)
+	}
+	return teams
+}
+
+// Observers returns the players watching the game, including referees.
+func (r Replay) Observers() []*Player {
+	var observers []*Player
+	for _, slot := range r.Slots {
+		if slot.IsObserver && slot.Player != nil {
+			observers = append(observers, slot.Player)
+		}
+	}
+	return observers
+}
+
+// teamResult goes by WinnerTeam, or if that's unknown, whether any of the team's players won
+func (r Replay) teamResult(team Team) PlayerResult {
+	switch {
+	case r.WinnerTeam == -1:
+		return ResultDraw
+	case r.WinnerTeam == team.Number:
+		return ResultWon
+	case r.WinnerTeam > 0:
+		return ResultLost
+	}
+	for _, player := range team.Players {
+		if player.Result == ResultWon {
+			return ResultWon
+		}
+	}
+	return ResultUnknown
+}
@@ -0,0 +1,27 @@
+package warcrumb
+
+import "testing"
+
+func TestTeams(t *testing.T) {
+	rep := parseTestReplay(t, "W3R-28524-Lyn(O) vs LawLiet(NE).w3g")
+	if observers := rep.Observers(); len(observers) != 4 {
+		t.Errorf("got %d observers, want 4", len(observers))
+	}
+	if rep.Saver == nil || !rep.Saver.slot.IsObserver {
+		t.Fatalf("expected the saver to be an observer")
+	}
+	if rep.WinnerTeam != 0 {
+		t.Errorf("WinnerTeam = %d, but the saver was only watching", rep.WinnerTeam)
+	}
+	teams := rep.Teams()
+	if len(teams) != 2 || len(teams[0].Players) != 1 || len(teams[1].Players) != 1 {
+		t.Fatalf("unexpected teams: %+v", teams)
+	}
+	if teams[0].Races[0] != Orc || teams[1].Races[0] != NightElf {
+		t.Errorf("unexpected races: %s, %s", teams[0].Races, teams[1].Races)
+	}
+
+	if c := colorByIndex(24); c.String() != "Color 24" {
+		t.Errorf("colorByIndex(24) = %s", c)
+	}
+}
@@ -0,0 +1,76 @@
+package warcrumb
+
+import "time"
+
+// buildGameFlowTimeline fills in rep.Pauses, rep.SpeedChanges and rep.SaveGames from the actions, which get their times from the time slots.
+// end is the time of the last time slot, used for a pause that was never resumed.
+func buildGameFlowTimeline(rep *Replay, end time.Duration) {
+	speed := rep.GameOptions.Speed
+	var openPause *PauseEvent
+	for _, action := range rep.Actions {
+		switch ability := action.Ability.(type) {
+		case PauseGame:
+			if openPause == nil {
+				openPause = &PauseEvent{Player: action.Player, Start: action.Time}
+			}
+		case ResumeGame:
+			if openPause != nil {
+				openPause.End = action.Time
+				openPause.ResumedBy = action.Player
+				rep.Pauses = append(rep.Pauses, *openPause)
+				openPause = nil
+			}
+		case SetGameSpeed:
+			speed = ability.Speed
+			rep.SpeedChanges = append(rep.SpeedChanges, SpeedChange{action.Player, action.Time, speed})
+		case IncreaseGameSpeed:
+			if speed < FastSpeed {
+				speed++
+			}
+			rep.SpeedChanges = append(rep.SpeedChanges, SpeedChange{action.Player, action.Time, speed})
+		case DecreaseGameSpeed:
+			if speed > SlowSpeed {
+				speed--
+			}
+			rep.SpeedChanges = append(rep.SpeedChanges, SpeedChange{action.Player, action.Time, speed})
+		case SaveGame:
+			rep.SaveGames = append(rep.SaveGames, SaveGameEvent{Player: action.Player, Time: action.Time, Filename: ability.Filename})
+		case SaveGameFinished:
+			// match it up with the player's latest unfinished save
+			for i := len(rep.SaveGames) - 1; i >= 0; i-- {
+				if rep.SaveGames[i].Player == action.Player && rep.SaveGames[i].Finished == 0 {
+					rep.SaveGames[i].Finished = action.Time
+					break
+				}
+			}
+		}
+	}
+	if openPause != nil {
+		openPause.End = end
+		rep.Pauses = append(rep.Pauses, *openPause)
+	}
+}
+
+// Duration returns how long the game was paused for.
+func (p PauseEvent) Duration() time.Duration {
+	return p.End - p.Start
+}
+
+// TotalPauseTime adds up the durations of all pauses started by the player.
+func (r Replay) TotalPauseTime(player *Player) (total time.Duration) {
+	for _, pause := range r.Pauses {
+		if pause.Player == player {
+			total += pause.Duration()
+		}
+	}
+	return total
+}
+
+// collectTriggerChat fills in rep.TriggerChat from TriggerChatCommand actions
+func collectTriggerChat(rep *Replay) {
+	for _, action := range rep.Actions {
+		if command, ok := action.Ability.(TriggerChatCommand); ok {
+			rep.TriggerChat = append(rep.TriggerChat, TriggerChatEvent{action.Time, action.Player, command.Text})
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package warcrumb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPauses(t *testing.T) {
+	rep := parseTestReplay(t, "W3R-28524-Lyn(O) vs LawLiet(NE).w3g")
+	if len(rep.Pauses) != 1 {
+		t.Fatalf("expected 1 pause, got %v", rep.Pauses)
+	}
+	pause := rep.Pauses[0]
+	if pause.Player == nil || pause.ResumedBy == nil || pause.Start != 660*time.Millisecond || pause.End != 47586*time.Millisecond {
+		t.Errorf("unexpected pause: %+v", pause)
+	}
+	if got := rep.TotalPauseTime(pause.Player); got != pause.Duration() {
+		t.Errorf("TotalPauseTime() = %s, want %s", got, pause.Duration())
+	}
+}
+
+func TestTriggerChat(t *testing.T) {
+	rep := parseTestReplay(t, "reforgedPudgeWars.w3g")
+	if len(rep.TriggerChat) != 2 || rep.TriggerChat[0].Text != "-km 50" || rep.TriggerChat[0].Player == nil {
+		t.Errorf("unexpected TriggerChat: %+v", rep.TriggerChat)
+	}
+	// "gg" was said in chat as well, "-km 50" wasn't
+	found := 0
+	for _, msg := range rep.ChatMessages {
+		for _, event := range rep.TriggerChat {
+			if msg.Body == event.Text && msg.Author.Player == event.Player {
+				found++
+			}
+		}
+	}
+	if found != 1 {
+		t.Errorf("%d trigger chat events are also in ChatMessages, want 1", found)
+	}
+}